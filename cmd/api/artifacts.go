@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"gertanoh.job-scheduler/internal/blobstore"
+	"gertanoh.job-scheduler/internal/data"
+	"github.com/labstack/echo/v4"
+)
+
+// artifact is an artifact of an execution along with the links to download it
+type artifact struct {
+	*data.ExecutionArtifact
+	DownloadURL string `json:"download_url"`
+	// URL downloads the artifact without credentials until URLExpiresAt
+	URL          string     `json:"url,omitempty"`
+	URLExpiresAt *time.Time `json:"url_expires_at,omitempty"`
+}
+
+// get request to list the artifacts kept from the workspace of an execution
+func (app *application) listExecutionArtifactsHandler(c echo.Context) error {
+	id, err := app.readIDParam(c, "execution_id")
+	if err != nil {
+		return app.notFoundResponse(c)
+	}
+
+	execution, err := app.models.JobExecutions.GetForUser(id, app.contextGetUserID(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return app.notFoundResponse(c)
+		default:
+			return app.serverErrorResponse(c, err)
+		}
+	}
+
+	executionArtifacts, err := app.models.Artifacts.GetAllForExecution(execution.ID)
+	if err != nil {
+		return app.serverErrorResponse(c, err)
+	}
+
+	artifacts := make([]artifact, 0, len(executionArtifacts))
+	for _, a := range executionArtifacts {
+		item := artifact{
+			ExecutionArtifact: a,
+			DownloadURL:       fmt.Sprintf("/api/v1/executions/%d/artifacts/%d", execution.ID, a.ID),
+		}
+
+		expiresAt := time.Now().Add(app.config.blobs.urlTTL).UTC()
+		url, err := app.blobs.URL(c.Request().Context(), a.BlobKey, app.config.blobs.urlTTL)
+		switch {
+		case err == nil:
+			item.URL, item.URLExpiresAt = url, &expiresAt
+		case !errors.Is(err, blobstore.ErrURLNotSupported) && !errors.Is(err, blobstore.ErrNotFound):
+			return app.serverErrorResponse(c, err)
+		}
+		artifacts = append(artifacts, item)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"artifacts": artifacts})
+}
+
+// get request to download the content of an artifact
+func (app *application) downloadArtifactHandler(c echo.Context) error {
+	id, err := app.readIDParam(c, "execution_id")
+	if err != nil {
+		return app.notFoundResponse(c)
+	}
+	artifactID, err := app.readIDParam(c, "artifact_id")
+	if err != nil {
+		return app.notFoundResponse(c)
+	}
+
+	execution, err := app.models.JobExecutions.GetForUser(id, app.contextGetUserID(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return app.notFoundResponse(c)
+		default:
+			return app.serverErrorResponse(c, err)
+		}
+	}
+
+	a, err := app.models.Artifacts.Get(execution.ID, artifactID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return app.notFoundResponse(c)
+		default:
+			return app.serverErrorResponse(c, err)
+		}
+	}
+
+	content, err := app.blobs.Get(c.Request().Context(), a.BlobKey)
+	if err != nil {
+		switch {
+		case errors.Is(err, blobstore.ErrNotFound):
+			return app.notFoundResponse(c)
+		default:
+			return app.serverErrorResponse(c, err)
+		}
+	}
+	defer content.Close()
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(a.Path)}))
+	header.Set(echo.HeaderContentLength, strconv.FormatInt(a.Size, 10))
+	header.Set("ETag", strconv.Quote(a.SHA256))
+	return c.Stream(http.StatusOK, echo.MIMEOctetStream, content)
+}
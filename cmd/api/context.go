@@ -0,0 +1,22 @@
+package main
+
+import (
+	"github.com/labstack/echo/v4"
+)
+
+const userIDContextKey = "user_id"
+
+// devUserID owns the jobs submitted without logging in, in the dev environment
+const devUserID = "dev"
+
+// contextSetUserID stores the OIDC subject of the authenticated user in the request context
+func (app *application) contextSetUserID(c echo.Context, userID string) {
+	c.Set(userIDContextKey, userID)
+}
+
+// contextGetUserID returns the OIDC subject of the authenticated user, empty
+// when the request is anonymous
+func (app *application) contextGetUserID(c echo.Context) string {
+	userID, _ := c.Get(userIDContextKey).(string)
+	return userID
+}
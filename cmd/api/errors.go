@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// errorResponse sends a JSON-formatted error message to the client
+func (app *application) errorResponse(c echo.Context, status int, message interface{}) error {
+	return c.JSON(status, map[string]interface{}{"error": message})
+}
+
+// serverErrorResponse logs the unexpected error and sends a generic 500 to the client
+func (app *application) serverErrorResponse(c echo.Context, err error) error {
+	app.logger.Error("Internal server error",
+		zap.String("method", c.Request().Method),
+		zap.String("uri", c.Request().URL.RequestURI()),
+		zap.Error(err))
+
+	message := "the server encountered a problem and could not process your request"
+	return app.errorResponse(c, http.StatusInternalServerError, message)
+}
+
+func (app *application) notFoundResponse(c echo.Context) error {
+	message := "the requested resource could not be found"
+	return app.errorResponse(c, http.StatusNotFound, message)
+}
+
+func (app *application) badRequestResponse(c echo.Context, err error) error {
+	return app.errorResponse(c, http.StatusBadRequest, err.Error())
+}
+
+func (app *application) failedValidationResponse(c echo.Context, errors map[string]string) error {
+	return app.errorResponse(c, http.StatusUnprocessableEntity, errors)
+}
+
+// conflictResponse is sent when the request does not apply to the current state of the resource
+func (app *application) conflictResponse(c echo.Context, err error) error {
+	return app.errorResponse(c, http.StatusConflict, err.Error())
+}
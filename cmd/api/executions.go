@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"gertanoh.job-scheduler/internal/data"
+	"gertanoh.job-scheduler/internal/validator"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// get request to list the execution history of a job, most recent first by default
+func (app *application) listJobExecutionsHandler(c echo.Context) error {
+	jobID, err := app.readIDParam(c, "job_id")
+	if err != nil {
+		return app.notFoundResponse(c)
+	}
+
+	userID := app.contextGetUserID(c)
+	if _, err := app.models.Jobs.GetForUser(jobID, userID); err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return app.notFoundResponse(c)
+		default:
+			return app.serverErrorResponse(c, err)
+		}
+	}
+
+	var input struct {
+		Status string
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := c.QueryParams()
+
+	input.Status = app.readString(qs, "status", "")
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-execution_time")
+	input.Filters.SortSafelist = []string{"id", "execution_time", "-id", "-execution_time"}
+
+	data.ValidateExecutionStatus(v, input.Status)
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		return app.failedValidationResponse(c, v.Errors)
+	}
+
+	executions, metadata, err := app.models.JobExecutions.GetAllForJob(jobID, userID, input.Status, input.Filters)
+	if err != nil {
+		return app.serverErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"executions": executions,
+		"metadata":   metadata,
+	})
+}
+
+// get request to retrieve a single execution along with the state of its steps
+// and every attempt of its run
+func (app *application) showExecutionHandler(c echo.Context) error {
+	id, err := app.readIDParam(c, "execution_id")
+	if err != nil {
+		return app.notFoundResponse(c)
+	}
+
+	execution, err := app.models.JobExecutions.GetForUser(id, app.contextGetUserID(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return app.notFoundResponse(c)
+		default:
+			return app.serverErrorResponse(c, err)
+		}
+	}
+
+	steps, err := app.models.Steps.GetAllForExecution(execution.ID)
+	if err != nil {
+		return app.serverErrorResponse(c, err)
+	}
+
+	attempts, err := app.models.JobExecutions.GetAttempts(execution.ID)
+	if err != nil {
+		return app.serverErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"execution": execution, "steps": steps, "attempts": attempts})
+}
+
+// post request to cancel an execution that is queued or running. A queued
+// execution is cancelled right away, a running one is flagged cancelling: its
+// executor stops the running step, runs the steps marked always and records it
+// as cancelled.
+func (app *application) cancelExecutionHandler(c echo.Context) error {
+	id, err := app.readIDParam(c, "execution_id")
+	if err != nil {
+		return app.notFoundResponse(c)
+	}
+
+	userID := app.contextGetUserID(c)
+	execution, err := app.models.JobExecutions.GetForUser(id, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return app.notFoundResponse(c)
+		default:
+			return app.serverErrorResponse(c, err)
+		}
+	}
+
+	err = app.models.Transaction(c.Request().Context(), func(tx data.Models) error {
+		return tx.CancelExecution(execution, "cancelled by the user")
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidTransition):
+			return app.conflictResponse(c, fmt.Errorf("execution %d is not running anymore", execution.ID))
+		default:
+			return app.serverErrorResponse(c, err)
+		}
+	}
+
+	app.logger.Info("Execution cancellation requested",
+		zap.Int64("job_id", execution.JobID),
+		zap.Int64("execution_id", execution.ID),
+		zap.String("status", execution.Status))
+
+	execution, err = app.models.JobExecutions.GetForUser(id, userID)
+	if err != nil {
+		return app.serverErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusAccepted, map[string]interface{}{"execution": execution})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+
+	"gertanoh.job-scheduler/internal/validator"
+	"github.com/labstack/echo/v4"
+)
+
+// readIDParam reads a positive integer id from the named path parameter
+func (app *application) readIDParam(c echo.Context, name string) (int64, error) {
+	id, err := strconv.ParseInt(c.Param(name), 10, 64)
+	if err != nil || id < 1 {
+		return 0, errors.New("invalid id parameter")
+	}
+	return id, nil
+}
+
+// readString returns a string value from the query string, or the default value
+func (app *application) readString(qs url.Values, key string, defaultValue string) string {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	return s
+}
+
+// readInt returns an integer value from the query string, or the default value.
+// A value that is not an integer is recorded in the validator.
+func (app *application) readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		v.AddError(key, "must be an integer value")
+		return defaultValue
+	}
+	return i
+}
+
+// readBool returns a boolean value from the query string, or the default value.
+// A value that is not a boolean is recorded in the validator.
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+	return b
+}
@@ -1,65 +1,246 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"time"
 
+	"gertanoh.job-scheduler/internal/data"
+	"gertanoh.job-scheduler/internal/schedule"
+	"gertanoh.job-scheduler/internal/scheduler"
+	"gertanoh.job-scheduler/internal/validator"
 	"gertanoh.job-scheduler/internal/ymlparser"
 	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
 )
 
 // post request to submit a job
+// Every job of the document is stored along with its schedule in a single
+// transaction, either all of them are created or none is.
 func (app *application) submitJobHandler(c echo.Context) error {
 
 	// Read the request body
 	yamlData, err := io.ReadAll(c.Request().Body)
 	if err != nil {
-		return c.String(http.StatusBadRequest, "Failed to read request body")
+		return app.badRequestResponse(c, errors.New("failed to read request body"))
 	}
 
-	_, err = ymlparser.ParseYAML(yamlData)
+	specs, err := ymlparser.ParseYAML(yamlData)
 	if err != nil {
-		return c.String(http.StatusBadRequest, "Failed to convert body into yaml struct")
+		return app.badRequestResponse(c, fmt.Errorf("failed to convert body into yaml struct: %v", err))
+	}
+	if len(specs) == 0 {
+		return app.badRequestResponse(c, errors.New("no job found in the request body"))
+	}
+
+	// jobs cannot ask for more than the cluster maximum, the limits they leave
+	// unset default to it
+	if app.config.limits != (ymlparser.Resources{}) {
+		for i := range specs {
+			spec := &specs[i]
+			if spec.Resources == nil {
+				spec.Resources = &ymlparser.Resources{}
+			}
+			if err := spec.Resources.ApplyLimits(app.config.limits); err != nil {
+				return app.badRequestResponse(c, fmt.Errorf("job %q: invalid resources: %v", spec.Name, err))
+			}
+		}
+	}
+
+	// compute the first fire times upfront, so that a job that would never run
+	// rejects the whole document before anything is written
+	now := time.Now()
+	firstExecutions := make([]time.Time, len(specs))
+	for i, spec := range specs {
+		next, err := scheduler.NextExecution(spec.Schedule, spec.Timezone, now)
+		if err != nil {
+			return app.badRequestResponse(c, fmt.Errorf("job %q: %v", spec.Name, err))
+		}
+		if next.IsZero() {
+			return app.badRequestResponse(c, fmt.Errorf("job %q: schedule %q never fires", spec.Name, spec.Schedule))
+		}
+		firstExecutions[i] = next
 	}
 
-	// app.logger.Info("len of job : ", zap.Int("len", len(jobs)))
+	userID := app.contextGetUserID(c)
+	created := make([]map[string]interface{}, 0, len(specs))
+	err = app.models.Transaction(c.Request().Context(), func(tx data.Models) error {
+		for i, spec := range specs {
+			job := &data.Job{UserID: userID, Job: spec}
+			if err := tx.Jobs.Insert(job); err != nil {
+				return err
+			}
+
+			jobSchedule := &data.JobSchedule{JobID: job.ID, NextExecution: firstExecutions[i].Unix()}
+			if err := tx.JobsSchedule.Insert(jobSchedule); err != nil {
+				return err
+			}
+
+			created = append(created, map[string]interface{}{
+				"id":   job.ID,
+				"name": job.Name,
+				"next_execution": map[string]interface{}{
+					"utc":   firstExecutions[i].UTC(),
+					"local": firstExecutions[i],
+				},
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return app.serverErrorResponse(c, err)
+	}
 
-	return c.String(http.StatusOK, "Request successful")
+	app.logger.Info("Jobs created", zap.Int("count", len(created)))
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{"jobs": created})
 }
 
 // get request to retrieve latest_execution
+// The next execution is given both in UTC and in the job's timezone.
 func (app *application) retrieveLatestExecutionStatus(c echo.Context) error {
 
-	jobId := c.Param("job_id")
+	jobID, err := app.readIDParam(c, "job_id")
+	if err != nil {
+		return app.notFoundResponse(c)
+	}
+
+	userID := app.contextGetUserID(c)
+	job, err := app.models.Jobs.GetForUser(jobID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return app.notFoundResponse(c)
+		default:
+			return app.serverErrorResponse(c, err)
+		}
+	}
+
+	loc, err := schedule.LoadLocation(job.Timezone)
+	if err != nil {
+		return app.serverErrorResponse(c, err)
+	}
+
+	// run_once jobs that already ran have no next execution
+	var nextExecution map[string]interface{}
+	jobSchedule, err := app.models.JobsSchedule.GetByJobID(job.ID)
+	switch {
+	case err == nil:
+		next := time.Unix(jobSchedule.NextExecution, 0)
+		nextExecution = map[string]interface{}{
+			"utc":   next.UTC(),
+			"local": next.In(loc),
+		}
+	case !errors.Is(err, data.ErrRecordNotFound):
+		return app.serverErrorResponse(c, err)
+	}
 
-	// retrieve info from db
+	// a job that never ran has no execution status yet
+	var executionStatus interface{}
+	latest, err := app.models.JobExecutions.GetLatestForJob(job.ID, userID)
+	switch {
+	case err == nil:
+		executionStatus = latest.Status
+	case !errors.Is(err, data.ErrRecordNotFound):
+		return app.serverErrorResponse(c, err)
+	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"job_id":            jobId,
-		"execution_status ": "running",
+		"job_id":           job.ID,
+		"execution_status": executionStatus,
+		"latest_execution": latest,
+		"timezone":         job.Timezone,
+		"next_execution":   nextExecution,
 	})
 }
 
-// func to retrieve last execution logs
-func (app *application) retrieveLatestExecutionLogs(c echo.Context) error {
-	jobId := c.Param("job_id")
+// post request to cancel a job: it is removed from the schedule and will not run
+// anymore, its history is kept. With cancel_runs=true its queued and running
+// executions are cancelled as well, the running ones by their executor.
+func (app *application) cancelJobHandler(c echo.Context) error {
+	jobID, err := app.readIDParam(c, "job_id")
+	if err != nil {
+		return app.notFoundResponse(c)
+	}
+
+	v := validator.New()
+	cancelRuns := app.readBool(c.QueryParams(), "cancel_runs", false, v)
+	if !v.Valid() {
+		return app.failedValidationResponse(c, v.Errors)
+	}
 
-	// retrieve info from S3
+	job, err := app.models.Jobs.GetForUser(jobID, app.contextGetUserID(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return app.notFoundResponse(c)
+		default:
+			return app.serverErrorResponse(c, err)
+		}
+	}
+
+	cancelled := []*data.JobExecution{}
+	err = app.models.Transaction(c.Request().Context(), func(tx data.Models) error {
+		jobSchedule, err := tx.JobsSchedule.GetByJobID(job.ID)
+		switch {
+		case err == nil:
+			if err := tx.JobsSchedule.Delete(jobSchedule.ID); err != nil {
+				return err
+			}
+		case !errors.Is(err, data.ErrRecordNotFound):
+			return err
+		}
+
+		if !cancelRuns {
+			return nil
+		}
+		active, err := tx.JobExecutions.GetActiveForJob(job.ID)
+		if err != nil {
+			return err
+		}
+		for _, execution := range active {
+			err := tx.CancelExecution(execution, "job cancelled by the user")
+			switch {
+			case err == nil:
+				cancelled = append(cancelled, execution)
+			case !errors.Is(err, data.ErrInvalidTransition):
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return app.serverErrorResponse(c, err)
+	}
+
+	app.logger.Info("Job cancelled", zap.Int64("job_id", job.ID), zap.Int("cancelled_executions", len(cancelled)))
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"job_id":            jobId,
-		"execution_status ": "running",
+		"job_id":     job.ID,
+		"executions": cancelled,
 	})
 }
 
-// func to delete job
-func (app *application) removeJob(c echo.Context) error {
-	jobId := c.Param("job_id")
+// delete request to remove a job of the user, along with its schedule and history
+func (app *application) deleteJobHandler(c echo.Context) error {
+	jobID, err := app.readIDParam(c, "job_id")
+	if err != nil {
+		return app.notFoundResponse(c)
+	}
 
-	// retrieve info from DB
+	err = app.models.Jobs.Delete(jobID, app.contextGetUserID(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return app.notFoundResponse(c)
+		default:
+			return app.serverErrorResponse(c, err)
+		}
+	}
 
-	return c.JSON(http.StatusOK, map[string]interface{}{
-		"job_id":            jobId,
-		"execution_status ": "deleted",
-	})
+	app.logger.Info("Job deleted", zap.Int64("job_id", jobID))
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"message": "job successfully deleted"})
 }
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"gertanoh.job-scheduler/internal/data"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// logListener listens to the notifications of the executors publishing logs
+// and wakes up the streams of the notified executions
+type logListener struct {
+	listener *pq.Listener
+	logger   *zap.Logger
+
+	mu      sync.Mutex
+	streams map[int64]map[chan struct{}]struct{}
+	// done is closed once the listener is closed, ending the streams
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newLogListener(dsn string, logger *zap.Logger) (*logListener, error) {
+	l := &logListener{
+		logger:  logger,
+		streams: map[int64]map[chan struct{}]struct{}{},
+		done:    make(chan struct{}),
+	}
+	l.listener = pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.Warn("Log listener connection lost", zap.Error(err))
+		}
+	})
+	if err := l.listener.Listen(data.LogsChannel); err != nil {
+		l.listener.Close()
+		return nil, err
+	}
+
+	go l.run()
+	return l, nil
+}
+
+func (l *logListener) run() {
+	for n := range l.listener.Notify {
+		// a nil notification follows a reconnection, some may have been missed
+		if n == nil {
+			l.wakeAll()
+			continue
+		}
+		id, err := strconv.ParseInt(n.Extra, 10, 64)
+		if err != nil {
+			continue
+		}
+		l.wake(id)
+	}
+}
+
+// subscribe returns a channel receiving a value when logs of the execution
+// were published since the last receive. unsubscribe releases it.
+func (l *logListener) subscribe(executionID int64) (notified <-chan struct{}, unsubscribe func()) {
+	ch := make(chan struct{}, 1)
+
+	l.mu.Lock()
+	if l.streams[executionID] == nil {
+		l.streams[executionID] = map[chan struct{}]struct{}{}
+	}
+	l.streams[executionID][ch] = struct{}{}
+	l.mu.Unlock()
+
+	return ch, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.streams[executionID], ch)
+		if len(l.streams[executionID]) == 0 {
+			delete(l.streams, executionID)
+		}
+	}
+}
+
+func (l *logListener) wake(executionID int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for ch := range l.streams[executionID] {
+		notify(ch)
+	}
+}
+
+func (l *logListener) wakeAll() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, streams := range l.streams {
+		for ch := range streams {
+			notify(ch)
+		}
+	}
+}
+
+// close stops listening and ends the streams
+func (l *logListener) close() {
+	l.closeOnce.Do(func() {
+		close(l.done)
+		l.listener.Close()
+	})
+}
+
+// notify sends to a channel without blocking, a pending value stands for both
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
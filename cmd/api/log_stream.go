@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"gertanoh.job-scheduler/internal/data"
+	"gertanoh.job-scheduler/internal/logline"
+	"gertanoh.job-scheduler/internal/validator"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// streamPollInterval is how long a stream waits for a notification before
+	// checking for new logs anyway, idle streams get a keepalive as often
+	streamPollInterval = 5 * time.Second
+	// streamChunkLimit is the number of chunks read at once
+	streamChunkLimit = 100
+	// streamReadSize is the size of the batches of lines of stored logs
+	streamReadSize = 32 << 10
+	// wsWriteTimeout bounds the write of a websocket message
+	wsWriteTimeout = 10 * time.Second
+)
+
+var errShuttingDown = errors.New("the server is shutting down")
+
+// logEvent is a message of a log stream
+type logEvent struct {
+	// Offset is the position of the lines in the execution logs, Next the
+	// position following them, where a stream resumes
+	Offset int64          `json:"offset"`
+	Next   int64          `json:"next"`
+	Lines  []logline.Line `json:"lines,omitempty"`
+	// Status is set on the last event, with the final status of the execution
+	Status string `json:"status,omitempty"`
+}
+
+// get request to stream the logs of an execution as server-sent events. The
+// logs written so far are replayed, then the live output is sent until the
+// execution is over. A reconnecting client resumes from the Last-Event-ID
+// header, or from the offset query parameter. stream=<name> and step=<index>
+// select the lines of a stream or of a step.
+func (app *application) streamExecutionLogsHandler(c echo.Context) error {
+	id, err := app.readIDParam(c, "execution_id")
+	if err != nil {
+		return app.notFoundResponse(c)
+	}
+
+	v := validator.New()
+	offset := app.readStreamOffset(c, v)
+	filter := app.readLogFilter(c.QueryParams(), v)
+	if !v.Valid() {
+		return app.failedValidationResponse(c, v.Errors)
+	}
+
+	execution, err := app.models.JobExecutions.GetForUser(id, app.contextGetUserID(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return app.notFoundResponse(c)
+		default:
+			return app.serverErrorResponse(c, err)
+		}
+	}
+
+	w := c.Response()
+	// the stream outlives the write timeout of the server
+	if err := http.NewResponseController(w.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		app.logger.Warn("Failed to clear the write deadline of a log stream", zap.Error(err))
+	}
+	w.Header().Set(echo.HeaderContentType, "text/event-stream")
+	w.Header().Set(echo.HeaderCacheControl, "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	w.Flush()
+
+	err = app.tailLogs(c.Request().Context(), execution.ID, offset, filter, func(event logEvent) error {
+		return writeSSE(w, event)
+	})
+	if err != nil && c.Request().Context().Err() == nil {
+		if !errors.Is(err, errShuttingDown) {
+			app.logger.Error("Log stream failed", zap.Int64("execution_id", execution.ID), zap.Error(err))
+		}
+		message, _ := json.Marshal(map[string]string{"error": err.Error()})
+		fmt.Fprintf(w, "event: error\ndata: %s\n\n", message)
+		w.Flush()
+	}
+	// the response is already sent
+	return nil
+}
+
+// writeSSE writes a log event. The id of the log events is the offset
+// following their lines, where a reconnecting client resumes.
+func writeSSE(w *echo.Response, event logEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case event.Status != "":
+		_, err = fmt.Fprintf(w, "event: end\ndata: %s\n\n", payload)
+	case len(event.Lines) == 0:
+		_, err = fmt.Fprint(w, ": keepalive\n\n")
+	default:
+		_, err = fmt.Fprintf(w, "id: %d\nevent: log\ndata: %s\n\n", event.Next, payload)
+	}
+	if err != nil {
+		return err
+	}
+	w.Flush()
+	return nil
+}
+
+// get request to stream the logs of an execution over a websocket, every
+// message being a JSON log event. Like the server-sent events, the stream
+// replays the logs from the offset query parameter then follows the live output.
+func (app *application) streamExecutionLogsWSHandler(c echo.Context) error {
+	id, err := app.readIDParam(c, "execution_id")
+	if err != nil {
+		return app.notFoundResponse(c)
+	}
+
+	v := validator.New()
+	offset := app.readStreamOffset(c, v)
+	filter := app.readLogFilter(c.QueryParams(), v)
+	if !v.Valid() {
+		return app.failedValidationResponse(c, v.Errors)
+	}
+
+	execution, err := app.models.JobExecutions.GetForUser(id, app.contextGetUserID(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return app.notFoundResponse(c)
+		default:
+			return app.serverErrorResponse(c, err)
+		}
+	}
+
+	server := websocket.Server{
+		Handshake: wsHandshake,
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+			// the deadlines of the server do not apply to the hijacked connection
+			ws.SetReadDeadline(time.Time{})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			// the client sends nothing, a failed read means it went away
+			go func() {
+				io.Copy(io.Discard, ws)
+				cancel()
+			}()
+
+			err := app.tailLogs(ctx, execution.ID, offset, filter, func(event logEvent) error {
+				ws.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+				return websocket.JSON.Send(ws, event)
+			})
+			if err != nil && ctx.Err() == nil && !errors.Is(err, errShuttingDown) {
+				app.logger.Error("Log stream failed", zap.Int64("execution_id", execution.ID), zap.Error(err))
+			}
+		},
+	}
+	server.ServeHTTP(c.Response(), c.Request())
+	return nil
+}
+
+// wsHandshake accepts the clients without an origin, like command line tools,
+// and the browsers on the origin of the API, so that other sites cannot read
+// the logs with the session of their visitors
+func wsHandshake(config *websocket.Config, req *http.Request) error {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host != req.Host {
+		return fmt.Errorf("websocket from another origin %q", origin)
+	}
+	config.Origin = u
+	return nil
+}
+
+// readStreamOffset returns the offset a stream starts at, from the
+// Last-Event-ID header of a reconnecting client or the offset query parameter
+func (app *application) readStreamOffset(c echo.Context, v *validator.Validator) int64 {
+	s := c.Request().Header.Get("Last-Event-ID")
+	if s == "" {
+		s = c.QueryParam("offset")
+	}
+	if s == "" {
+		return 0
+	}
+
+	offset, err := strconv.ParseInt(s, 10, 64)
+	v.Check(err == nil && offset >= 0, "offset", "must be a positive integer")
+	return offset
+}
+
+// tailLogs sends the lines of the logs of an execution matching the filter
+// from offset, then the lines it publishes until it is over. The last event
+// has the final status of the execution. While the execution runs the logs are
+// read from the published chunks, then from the blob store.
+func (app *application) tailLogs(ctx context.Context, executionID, offset int64, filter logline.Filter, send func(logEvent) error) error {
+	notified, unsubscribe := app.logListener.subscribe(executionID)
+	defer unsubscribe()
+
+	for {
+		// the status is read before the chunks: the logs of an execution over
+		// are stored before its status changes and its chunks are dropped
+		execution, err := app.models.JobExecutions.Get(executionID)
+		if err != nil {
+			return err
+		}
+		if execution.LogsPath != "" {
+			if offset, err = app.sendStoredLogs(ctx, execution.LogsPath, offset, filter, send); err != nil {
+				return err
+			}
+			return send(logEvent{Offset: offset, Next: offset, Status: execution.Status})
+		}
+
+		// the logs of an execution over without logs_path were never stored
+		over := data.IsFinalStatus(execution.Status)
+		sent := false
+		for {
+			chunks, err := app.models.LogChunks.GetFrom(executionID, offset, streamChunkLimit)
+			if err != nil {
+				return err
+			}
+			start, logs := joinChunks(chunks, offset)
+			n := len(logs)
+			if !over {
+				// a line split across chunks is sent once complete
+				n = bytes.LastIndexByte(logs, '\n') + 1
+			}
+			if n > 0 {
+				event := newLogEvent(start, logs[:n], filter)
+				if len(event.Lines) > 0 {
+					if err := send(event); err != nil {
+						return err
+					}
+					sent = true
+				}
+			}
+			offset = start + int64(n)
+			if len(chunks) < streamChunkLimit {
+				break
+			}
+		}
+		if over {
+			return send(logEvent{Offset: offset, Next: offset, Status: execution.Status})
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-app.logListener.done:
+			return errShuttingDown
+		case <-notified:
+		case <-time.After(streamPollInterval):
+			if !sent {
+				if err := send(logEvent{Offset: offset, Next: offset}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// sendStoredLogs sends the lines of the logs stored in the blob store matching
+// the filter from offset, and returns the offset following them
+func (app *application) sendStoredLogs(ctx context.Context, key string, offset int64, filter logline.Filter, send func(logEvent) error) (int64, error) {
+	logs, err := app.blobs.GetRange(ctx, key, offset, -1)
+	if err != nil {
+		return offset, err
+	}
+	defer logs.Close()
+
+	r := bufio.NewReaderSize(logs, streamReadSize)
+	var batch []byte
+	for {
+		// the lines are bounded by the log format
+		line, err := r.ReadBytes('\n')
+		batch = append(batch, line...)
+
+		if len(batch) >= streamReadSize || (err != nil && len(batch) > 0) {
+			event := newLogEvent(offset, batch, filter)
+			if len(event.Lines) > 0 {
+				if sendErr := send(event); sendErr != nil {
+					return offset, sendErr
+				}
+			}
+			offset, batch = event.Next, batch[:0]
+		}
+
+		switch {
+		case errors.Is(err, io.EOF):
+			return offset, nil
+		case err != nil:
+			return offset, err
+		}
+	}
+}
+
+// newLogEvent returns the event of the lines of the logs at offset matching the filter
+func newLogEvent(offset int64, logs []byte, filter logline.Filter) logEvent {
+	event := logEvent{Offset: offset, Next: offset + int64(len(logs))}
+	logline.Scan(bytes.NewReader(logs), func(_ []byte, line logline.Line) error {
+		if filter.Match(line) {
+			event.Lines = append(event.Lines, line)
+		}
+		return nil
+	})
+	return event
+}
+
+// joinChunks returns the contiguous logs of the chunks from offset, and where
+// they start. They start after offset when the chunks before were dropped.
+func joinChunks(chunks []*data.LogChunk, offset int64) (int64, []byte) {
+	start := offset
+	var logs []byte
+	for _, chunk := range chunks {
+		end := start + int64(len(logs))
+		if chunk.Offset > end {
+			if len(logs) > 0 {
+				break
+			}
+			start, end = chunk.Offset, chunk.Offset
+		}
+		logs = append(logs, chunk.Data[end-chunk.Offset:]...)
+	}
+	return start, logs
+}
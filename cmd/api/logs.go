@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"gertanoh.job-scheduler/internal/blobstore"
+	"gertanoh.job-scheduler/internal/data"
+	"gertanoh.job-scheduler/internal/logline"
+	"gertanoh.job-scheduler/internal/validator"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// get request to retrieve the logs of an execution, or with step=<index> the
+// output of one of its steps
+func (app *application) showExecutionLogsHandler(c echo.Context) error {
+	id, err := app.readIDParam(c, "execution_id")
+	if err != nil {
+		return app.notFoundResponse(c)
+	}
+
+	execution, err := app.models.JobExecutions.GetForUser(id, app.contextGetUserID(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return app.notFoundResponse(c)
+		default:
+			return app.serverErrorResponse(c, err)
+		}
+	}
+
+	return app.writeExecutionLogs(c, execution)
+}
+
+// get request to retrieve the logs of the latest execution of a job
+func (app *application) retrieveLatestExecutionLogs(c echo.Context) error {
+	jobID, err := app.readIDParam(c, "job_id")
+	if err != nil {
+		return app.notFoundResponse(c)
+	}
+
+	execution, err := app.models.JobExecutions.GetLatestForJob(jobID, app.contextGetUserID(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return app.notFoundResponse(c)
+		default:
+			return app.serverErrorResponse(c, err)
+		}
+	}
+
+	return app.writeExecutionLogs(c, execution)
+}
+
+// writeExecutionLogs streams the logs of an execution from the blob store, as
+// plain text or with format=jsonl as the stored JSON lines. stream=<name> and
+// step=<index> select the lines of a stream or of a step. The logs are stored
+// once the execution is over.
+func (app *application) writeExecutionLogs(c echo.Context, execution *data.JobExecution) error {
+	v := validator.New()
+	qs := c.QueryParams()
+	format := app.readString(qs, "format", "text")
+	v.Check(validator.PermittedValue(format, "text", "jsonl"), "format", "must be text or jsonl")
+	filter := app.readLogFilter(qs, v)
+	if !v.Valid() {
+		return app.failedValidationResponse(c, v.Errors)
+	}
+
+	if execution.LogsPath == "" {
+		return app.errorResponse(c, http.StatusNotFound, fmt.Sprintf("the logs of execution %d are not stored yet", execution.ID))
+	}
+
+	// the lines of a step are a slice of the execution logs
+	offset, length := int64(0), int64(-1)
+	if filter.Step != nil {
+		steps, err := app.models.Steps.GetAllForExecution(execution.ID)
+		if err != nil {
+			return app.serverErrorResponse(c, err)
+		}
+		found := false
+		for _, s := range steps {
+			if s.Index == *filter.Step {
+				offset, length, found = s.LogOffset, s.LogLength, true
+				break
+			}
+		}
+		if !found {
+			return app.notFoundResponse(c)
+		}
+		// which also selects the lines of the logs stored as plain text
+		filter.Step = nil
+	}
+
+	logs, err := app.blobs.GetRange(c.Request().Context(), execution.LogsPath, offset, length)
+	if err != nil {
+		switch {
+		case errors.Is(err, blobstore.ErrNotFound):
+			return app.notFoundResponse(c)
+		default:
+			return app.serverErrorResponse(c, err)
+		}
+	}
+	defer logs.Close()
+
+	w := c.Response()
+	if format == "jsonl" {
+		w.Header().Set(echo.HeaderContentType, "application/x-ndjson")
+	} else {
+		w.Header().Set(echo.HeaderContentType, echo.MIMETextPlainCharsetUTF8)
+	}
+	w.WriteHeader(http.StatusOK)
+
+	err = logline.Scan(logs, func(raw []byte, line logline.Line) error {
+		if !filter.Match(line) {
+			return nil
+		}
+		if format == "jsonl" {
+			_, err := w.Write(append(raw, '\n'))
+			return err
+		}
+		_, err := io.WriteString(w, line.Text+"\n")
+		return err
+	})
+	if err != nil && c.Request().Context().Err() == nil {
+		app.logger.Error("Failed to send logs", zap.Int64("execution_id", execution.ID), zap.Error(err))
+	}
+	// the response is already sent
+	return nil
+}
+
+// readLogFilter returns the lines selected by the stream and step query
+// parameters. Invalid values are recorded in the validator.
+func (app *application) readLogFilter(qs url.Values, v *validator.Validator) logline.Filter {
+	var filter logline.Filter
+
+	filter.Stream = app.readString(qs, "stream", "")
+	v.Check(filter.Stream == "" || validator.PermittedValue(filter.Stream, logline.Streams...), "stream", "must be stdout, stderr or system")
+
+	if qs.Get("step") != "" {
+		step := app.readInt(qs, "step", 0, v)
+		v.Check(step >= 0, "step", "must be a positive integer")
+		filter.Step = &step
+	}
+	return filter
+}
+
+// get request to download a blob through a URL signed by the blob store, which
+// stands for the credentials of the request
+func (app *application) signedBlobHandler(c echo.Context) error {
+	// echo matches the escaped path when the request has one
+	key := c.Param("*")
+	if c.Request().URL.RawPath != "" {
+		unescaped, err := url.PathUnescape(key)
+		if err != nil {
+			return app.notFoundResponse(c)
+		}
+		key = unescaped
+	}
+	if err := app.blobSigner.Verify(key, c.QueryParams()); err != nil {
+		return app.errorResponse(c, http.StatusForbidden, err.Error())
+	}
+
+	blob, err := app.blobs.Get(c.Request().Context(), key)
+	if err != nil {
+		switch {
+		case errors.Is(err, blobstore.ErrNotFound):
+			return app.notFoundResponse(c)
+		default:
+			return app.serverErrorResponse(c, err)
+		}
+	}
+	defer blob.Close()
+
+	// files of the filesystem store can serve ranges
+	if rs, ok := blob.(io.ReadSeeker); ok {
+		http.ServeContent(c.Response(), c.Request(), "", time.Time{}, rs)
+		return nil
+	}
+	return c.Stream(http.StatusOK, echo.MIMEOctetStream, blob)
+}
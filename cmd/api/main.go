@@ -2,13 +2,18 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
 	"flag"
 	"log"
+	"os"
 	"time"
+	_ "time/tzdata"
 
 	"gertanoh.job-scheduler/internal/authenticator"
+	"gertanoh.job-scheduler/internal/blobstore"
 	"gertanoh.job-scheduler/internal/data"
+	"gertanoh.job-scheduler/internal/ymlparser"
 	"github.com/joho/godotenv"
 	"go.uber.org/zap"
 )
@@ -19,6 +24,14 @@ type config struct {
 	db   struct {
 		dsn string
 	}
+	blobs struct {
+		blobstore.Config
+		// urlSecret signs the blob URLs served by the API, urlTTL is their validity
+		urlSecret string
+		urlTTL    time.Duration
+	}
+	// limits are the maximum resources a job can ask for, zero values are unbounded
+	limits ymlparser.Resources
 }
 
 // application config struct
@@ -27,6 +40,10 @@ type application struct {
 	auth   *authenticator.Authenticator
 	logger *zap.Logger
 	models data.Models
+	blobs  blobstore.Store
+	// blobSigner signs the URLs of the blobs the store does not serve itself
+	blobSigner  *blobstore.URLSigner
+	logListener *logListener
 }
 
 func main() {
@@ -36,6 +53,18 @@ func main() {
 	flag.IntVar(&cfg.port, "port", 8000, "API server port")
 	flag.StringVar(&cfg.env, "env", "dev", "Environment (dev|staging|prod)")
 	flag.StringVar(&cfg.db.dsn, "db-dsn", "", "PostgreSQL DSN")
+	flag.StringVar(&cfg.blobs.Backend, "blob-store", "fs", "Where the logs and artifacts are stored (fs|s3)")
+	flag.StringVar(&cfg.blobs.Dir, "blob-dir", "blobs", "Directory of the fs blob store")
+	flag.StringVar(&cfg.blobs.S3.Endpoint, "s3-endpoint", "https://s3.amazonaws.com", "URL of the S3 API of the s3 blob store")
+	flag.StringVar(&cfg.blobs.S3.Region, "s3-region", "us-east-1", "Region of the s3 blob store")
+	flag.StringVar(&cfg.blobs.S3.Bucket, "s3-bucket", "", "Bucket of the s3 blob store")
+	flag.StringVar(&cfg.blobs.urlSecret, "blob-url-secret", os.Getenv("BLOB_URL_SECRET"), "Secret signing the blob URLs of the fs blob store, random when empty")
+	flag.DurationVar(&cfg.blobs.urlTTL, "blob-url-ttl", 15*time.Minute, "Validity of the blob URLs handed out by the API")
+
+	flag.Float64Var(&cfg.limits.CPUs, "max-cpus", 0, "Maximum CPUs of a job (0 for no limit)")
+	flag.Var(&cfg.limits.Memory, "max-memory", "Maximum memory of a job, e.g. 4g (0 for no limit)")
+	flag.Int64Var(&cfg.limits.PIDs, "max-pids", 0, "Maximum number of processes of a job (0 for no limit)")
+	flag.Var(&cfg.limits.TmpfsSize, "max-tmpfs-size", "Maximum size of the /tmp of a job, e.g. 1g (0 for no limit)")
 
 	flag.Parse()
 
@@ -60,11 +89,37 @@ func main() {
 	defer db.Close()
 	logger.Info("DB connection setup")
 
+	secret := []byte(cfg.blobs.urlSecret)
+	if len(secret) == 0 {
+		// the URLs handed out do not survive a restart
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			logger.Fatal("Fail to generate the blob URL secret", zap.Error(err))
+		}
+	}
+	blobSigner := blobstore.NewURLSigner("/blobs", secret)
+
+	cfg.blobs.S3.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+	cfg.blobs.S3.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	blobs, err := blobstore.New(cfg.blobs.Config, blobSigner)
+	if err != nil {
+		logger.Fatal("Fail to setup the blob store", zap.Error(err))
+	}
+
+	listener, err := newLogListener(cfg.db.dsn, logger)
+	if err != nil {
+		logger.Fatal("Fail to listen to the published logs", zap.Error(err))
+	}
+	defer listener.close()
+
 	app := &application{
-		config: cfg,
-		auth:   authMethod,
-		logger: logger,
-		models: data.NewModels(db),
+		config:      cfg,
+		auth:        authMethod,
+		logger:      logger,
+		models:      data.NewModels(db),
+		blobs:       blobs,
+		blobSigner:  blobSigner,
+		logListener: listener,
 	}
 
 	app.serve()
@@ -37,15 +37,33 @@ func (app *application) Router() *echo.Echo {
 	e.Server.IdleTimeout = time.Minute
 
 	authGroup := e.Group("")
+	authGroup.Use(app.authenticate)
 	if app.config.env != "dev" {
 		authGroup.Use(app.isAuthenticated)
 	}
 	authGroup.GET("/user", app.userHandler)
 	authGroup.GET("/logout", app.logoutHandler)
 	authGroup.POST("/submitJob", app.submitJobHandler)
-	authGroup.POST("/jobLastExecutionStatus", app.retrieveLatestExecutionStatus)
-	authGroup.POST("/jobLastExecutionLogs", app.retrieveLatestExecutionLogs)
-	authGroup.POST("/removeJob", app.removeJob)
+
+	v1 := authGroup.Group("/api/v1")
+	v1.POST("/jobs", app.submitJobHandler)
+	v1.DELETE("/jobs/:job_id", app.deleteJobHandler)
+	v1.POST("/jobs/:job_id/cancel", app.cancelJobHandler)
+	v1.GET("/jobs/:job_id/status", app.retrieveLatestExecutionStatus)
+	v1.GET("/jobs/:job_id/executions", app.listJobExecutionsHandler)
+	v1.GET("/jobs/:job_id/logs", app.retrieveLatestExecutionLogs)
+	v1.GET("/jobs/:job_id/flaky-tests", app.listFlakyTestsHandler)
+	v1.GET("/executions/:execution_id", app.showExecutionHandler)
+	v1.POST("/executions/:execution_id/cancel", app.cancelExecutionHandler)
+	v1.GET("/executions/:execution_id/logs", app.showExecutionLogsHandler)
+	v1.GET("/executions/:execution_id/logs/stream", app.streamExecutionLogsHandler)
+	v1.GET("/executions/:execution_id/logs/ws", app.streamExecutionLogsWSHandler)
+	v1.GET("/executions/:execution_id/tests", app.listExecutionTestsHandler)
+	v1.GET("/executions/:execution_id/artifacts", app.listExecutionArtifactsHandler)
+	v1.GET("/executions/:execution_id/artifacts/:artifact_id", app.downloadArtifactHandler)
+
+	// signed URLs stand for the credentials
+	e.GET("/blobs/*", app.signedBlobHandler)
 
 	e.GET("/login", app.loginHandler)
 	e.GET("/callback", app.callbackHandler)
@@ -171,6 +189,29 @@ func generateRandomState() (string, error) {
 
 // middlewares
 
+// authenticate stores the subject of the session's profile in the request
+// context. In the dev environment anonymous requests act as devUserID.
+func (app *application) authenticate(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		sess, err := session.Get("session", c)
+		if err != nil {
+			app.logger.Error("Error getting the session")
+			return c.String(http.StatusInternalServerError, "Internal Server Error")
+		}
+
+		var userID string
+		if profile, ok := sess.Values["profile"].(map[string]interface{}); ok {
+			userID, _ = profile["sub"].(string)
+		}
+		if userID == "" && app.config.env == "dev" {
+			userID = devUserID
+		}
+		app.contextSetUserID(c, userID)
+
+		return next(c)
+	}
+}
+
 func (app *application) isAuthenticated(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		sess, err := session.Get("session", c)
@@ -179,8 +220,8 @@ func (app *application) isAuthenticated(next echo.HandlerFunc) echo.HandlerFunc
 			return c.String(http.StatusInternalServerError, "Internal Server Error")
 		}
 
-		// check if user is authenticated
-		if p, ok := sess.Values["profile"]; !ok || p == nil {
+		// check if user is authenticated, jobs are owned by the profile's subject
+		if p, ok := sess.Values["profile"]; !ok || p == nil || app.contextGetUserID(c) == "" {
 			return echo.NewHTTPError(http.StatusUnauthorized, "Not authenticated")
 		}
 
@@ -15,6 +15,8 @@ import (
 func (app *application) serve() {
 
 	e := app.Router()
+	// the log streams would hold the shutdown until its timeout
+	e.Server.RegisterOnShutdown(app.logListener.close)
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"gertanoh.job-scheduler/internal/data"
+	"gertanoh.job-scheduler/internal/gotest"
+	"gertanoh.job-scheduler/internal/validator"
+	"github.com/labstack/echo/v4"
+)
+
+// testCounts counts the results of a kind by status
+type testCounts struct {
+	Total   int `json:"total"`
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+}
+
+func (tc *testCounts) add(status string) {
+	tc.Total++
+	switch status {
+	case gotest.Pass:
+		tc.Passed++
+	case gotest.Fail:
+		tc.Failed++
+	case gotest.Skip:
+		tc.Skipped++
+	}
+}
+
+// testSummary counts the test results of an execution
+type testSummary struct {
+	Packages testCounts `json:"packages"`
+	Tests    testCounts `json:"tests"`
+	Subtests testCounts `json:"subtests"`
+}
+
+// get request to list the results of the go test -json commands of an
+// execution with their counts, the failures first. status=<status> and
+// kind=<kind> select the results listed, not the ones counted.
+func (app *application) listExecutionTestsHandler(c echo.Context) error {
+	id, err := app.readIDParam(c, "execution_id")
+	if err != nil {
+		return app.notFoundResponse(c)
+	}
+
+	v := validator.New()
+	qs := c.QueryParams()
+	status := app.readString(qs, "status", "")
+	v.Check(status == "" || validator.PermittedValue(status, gotest.Pass, gotest.Fail, gotest.Skip), "status", "must be pass, fail or skip")
+	kind := app.readString(qs, "kind", "")
+	v.Check(kind == "" || validator.PermittedValue(kind, gotest.KindPackage, gotest.KindTest, gotest.KindSubtest), "kind", "must be package, test or subtest")
+	if !v.Valid() {
+		return app.failedValidationResponse(c, v.Errors)
+	}
+
+	execution, err := app.models.JobExecutions.GetForUser(id, app.contextGetUserID(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return app.notFoundResponse(c)
+		default:
+			return app.serverErrorResponse(c, err)
+		}
+	}
+
+	results, err := app.models.TestResults.GetAllForExecution(execution.ID)
+	if err != nil {
+		return app.serverErrorResponse(c, err)
+	}
+
+	var summary testSummary
+	tests := make([]*data.ExecutionTestResult, 0, len(results))
+	for _, result := range results {
+		switch result.Kind {
+		case gotest.KindPackage:
+			summary.Packages.add(result.Status)
+		case gotest.KindTest:
+			summary.Tests.add(result.Status)
+		case gotest.KindSubtest:
+			summary.Subtests.add(result.Status)
+		}
+		if (status == "" || result.Status == status) && (kind == "" || result.Kind == kind) {
+			tests = append(tests, result)
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"summary": summary, "tests": tests})
+}
+
+// get request to list the tests of a job that both passed and failed on the
+// same commit in its last finished executions with a commit
+// (executions=<count>, 100 by default), the flakiest first
+func (app *application) listFlakyTestsHandler(c echo.Context) error {
+	jobID, err := app.readIDParam(c, "job_id")
+	if err != nil {
+		return app.notFoundResponse(c)
+	}
+
+	if _, err := app.models.Jobs.GetForUser(jobID, app.contextGetUserID(c)); err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return app.notFoundResponse(c)
+		default:
+			return app.serverErrorResponse(c, err)
+		}
+	}
+
+	v := validator.New()
+	executions := app.readInt(c.QueryParams(), "executions", 100, v)
+	v.Check(executions >= 2, "executions", "must be at least 2")
+	v.Check(executions <= 1000, "executions", "must be a maximum of 1000")
+	if !v.Valid() {
+		return app.failedValidationResponse(c, v.Errors)
+	}
+
+	tests, err := app.models.TestResults.GetFlakyForJob(jobID, executions)
+	if err != nil {
+		return app.serverErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"flaky_tests": tests, "executions": executions})
+}
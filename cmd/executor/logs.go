@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gertanoh.job-scheduler/internal/data"
+	"go.uber.org/zap"
+)
+
+const (
+	// storeLogsTimeout bounds the upload of the logs of an execution
+	storeLogsTimeout = 5 * time.Minute
+	// publishInterval is how often the output of a running execution is published
+	publishInterval = 500 * time.Millisecond
+	// maxChunkSize publishes the output before publishInterval elapsed once it grew that large
+	maxChunkSize = 64 << 10
+	// maxPendingLogs is the most output kept while publishing fails, the
+	// live stream skips what is dropped but the stored logs are complete
+	maxPendingLogs = 8 << 20
+)
+
+// createLogs creates the file the logs of an execution are spooled to while it runs
+func (app *application) createLogs(executionID int64) (*os.File, error) {
+	path := filepath.Join(app.config.logsDir, fmt.Sprintf("execution-%d.log", executionID))
+	return os.Create(path)
+}
+
+// storeLogs uploads the spooled logs of an execution to the blob store and
+// records their key, then drops the published chunks. The spool file is
+// removed once stored, it is kept when the upload fails so that the logs are
+// not lost.
+func (app *application) storeLogs(logger *zap.Logger, executionID int64, logs *os.File) {
+	key := fmt.Sprintf("logs/execution-%d.log", executionID)
+	logger = logger.With(zap.String("key", key))
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeLogsTimeout)
+	defer cancel()
+
+	if _, err := logs.Seek(0, io.SeekStart); err != nil {
+		logger.Error("Failed to read logs", zap.Error(err))
+		return
+	}
+	if _, err := app.blobs.Put(ctx, key, logs); err != nil {
+		logger.Error("Failed to store logs", zap.String("spool", logs.Name()), zap.Error(err))
+		return
+	}
+	if err := app.models.JobExecutions.SetLogsPath(executionID, key); err != nil {
+		logger.Error("Failed to record logs", zap.Error(err))
+		return
+	}
+	// streams switch to the stored logs once logs_path is set
+	if err := app.models.LogChunks.DeleteForExecution(executionID); err != nil {
+		logger.Warn("Failed to delete published logs", zap.Error(err))
+	}
+	if err := os.Remove(logs.Name()); err != nil {
+		logger.Warn("Failed to remove spooled logs", zap.Error(err))
+	}
+}
+
+// logPublisher writes the logs of an execution to its spool file and
+// publishes them in chunks, so that the API streams them while it runs
+type logPublisher struct {
+	logger      *zap.Logger
+	executionID int64
+	chunks      data.LogChunkModel
+	file        io.Writer
+
+	mu sync.Mutex
+	// pending is the output not published yet, starting at offset
+	pending []byte
+	offset  int64
+
+	full chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// publishLogs starts publishing what is written to the returned writer, until it is closed
+func (app *application) publishLogs(logger *zap.Logger, executionID int64, file io.Writer) *logPublisher {
+	p := &logPublisher{
+		logger:      logger,
+		executionID: executionID,
+		chunks:      app.models.LogChunks,
+		file:        file,
+		full:        make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+func (p *logPublisher) Write(b []byte) (int, error) {
+	n, err := p.file.Write(b)
+
+	p.mu.Lock()
+	p.pending = append(p.pending, b[:n]...)
+	full := len(p.pending) >= maxChunkSize
+	p.mu.Unlock()
+
+	if full {
+		// published by the loop, the writer is not blocked on the database
+		select {
+		case p.full <- struct{}{}:
+		default:
+		}
+	}
+	return n, err
+}
+
+// Close publishes the remaining output and stops publishing
+func (p *logPublisher) Close() error {
+	close(p.stop)
+	<-p.done
+	return nil
+}
+
+// run publishes the pending output every publishInterval, or once a chunk is full
+func (p *logPublisher) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(publishInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			p.publish()
+			return
+		case <-p.full:
+			p.publish()
+		case <-ticker.C:
+			p.publish()
+		}
+	}
+}
+
+// publish inserts the pending output as a chunk. It is kept for the next
+// attempt when the insert fails, up to maxPendingLogs.
+func (p *logPublisher) publish() {
+	p.mu.Lock()
+	chunk := &data.LogChunk{ExecutionID: p.executionID, Offset: p.offset, Data: p.pending}
+	p.mu.Unlock()
+	if len(chunk.Data) == 0 {
+		return
+	}
+
+	err := p.chunks.Insert(chunk)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil && len(p.pending) <= maxPendingLogs {
+		p.logger.Warn("Failed to publish logs", zap.Error(err))
+		return
+	}
+	if err != nil {
+		p.logger.Error("Dropping unpublished logs", zap.Int("bytes", len(chunk.Data)), zap.Error(err))
+	}
+	p.offset += int64(len(chunk.Data))
+	p.pending = p.pending[len(chunk.Data):]
+}
@@ -2,20 +2,37 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/client"
-	"github.com/docker/docker/pkg/stdcopy"
+	"gertanoh.job-scheduler/internal/blobstore"
+	"gertanoh.job-scheduler/internal/data"
+	"gertanoh.job-scheduler/internal/executor"
+	"gertanoh.job-scheduler/internal/runner"
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
 	"go.uber.org/zap"
-
 )
 
 type config struct {
-	env  string
-	db   struct {
+	env           string
+	executor      string
+	image         string
+	rootfs        string
+	logsDir       string
+	localRepos    string
+	blobs         blobstore.Config
+	workers       int
+	pollInterval  time.Duration
+	agingInterval time.Duration
+	stopGrace     time.Duration
+	db            struct {
 		dsn string
 	}
 }
@@ -24,15 +41,32 @@ type config struct {
 type application struct {
 	config config
 	logger *zap.Logger
+	models data.Models
+	blobs  blobstore.Store
+	runner *runner.Runner
 }
 
 // Add bash scripts pull golang image before executing executor
 func main() {
-	ctx := context.Background()
-
 	var cfg config
 
 	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
+	flag.StringVar(&cfg.db.dsn, "db-dsn", "", "PostgreSQL DSN")
+	flag.StringVar(&cfg.executor, "executor", "docker", "How the job steps are run (docker|sandbox|process)")
+	flag.StringVar(&cfg.rootfs, "rootfs", "", "Root filesystem directory of the sandbox executor")
+	flag.StringVar(&cfg.image, "image", "golang:latest", "Image the job steps run in")
+	flag.StringVar(&cfg.logsDir, "logs-dir", "logs", "Directory the execution logs are spooled to until they are stored")
+	flag.StringVar(&cfg.localRepos, "local-repos", "", "Directory the job sources given as local repositories are fetched from (none when empty)")
+	flag.StringVar(&cfg.blobs.Backend, "blob-store", "fs", "Where the logs and artifacts are stored (fs|s3)")
+	flag.StringVar(&cfg.blobs.Dir, "blob-dir", "blobs", "Directory of the fs blob store")
+	flag.StringVar(&cfg.blobs.S3.Endpoint, "s3-endpoint", "https://s3.amazonaws.com", "URL of the S3 API of the s3 blob store")
+	flag.StringVar(&cfg.blobs.S3.Region, "s3-region", "us-east-1", "Region of the s3 blob store")
+	flag.StringVar(&cfg.blobs.S3.Bucket, "s3-bucket", "", "Bucket of the s3 blob store")
+	flag.IntVar(&cfg.workers, "workers", 2, "Number of executions run concurrently")
+	flag.DurationVar(&cfg.pollInterval, "poll-interval", 2*time.Second, "Interval between two polls of an empty job queue")
+	flag.DurationVar(&cfg.agingInterval, "aging-interval", time.Minute, "Time spent in the queue for a job to gain one priority level (0 disables aging)")
+
+	flag.DurationVar(&cfg.stopGrace, "stop-grace", 10*time.Second, "Time a step stopped by a timeout or a cancellation has to exit before it is killed")
 
 	flag.Parse()
 
@@ -42,16 +76,82 @@ func main() {
 	logger := zap.Must(zap.NewProduction())
 	defer logger.Sync()
 
+	db, err := openDB(cfg)
+	if err != nil {
+		logger.Fatal("Fail to setup db", zap.Error(err))
+	}
+
+	defer db.Close()
+	logger.Info("DB connection setup")
+
+	stepExecutor, err := newExecutor(cfg, logger)
+	if err != nil {
+		logger.Fatal("Fail to setup the executor", zap.String("executor", cfg.executor), zap.Error(err))
+	}
+
+	if err := os.MkdirAll(cfg.logsDir, 0o755); err != nil {
+		logger.Fatal("Fail to create the logs directory", zap.Error(err))
+	}
+
+	cfg.blobs.S3.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+	cfg.blobs.S3.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	blobs, err := blobstore.New(cfg.blobs, nil)
+	if err != nil {
+		logger.Fatal("Fail to setup the blob store", zap.Error(err))
+	}
 
 	app := &application{
 		config: cfg,
 		logger: logger,
+		models: data.NewModels(db),
+		blobs:  blobs,
+		runner: runner.New(stepExecutor, cfg.image, "", cfg.localRepos, cfg.stopGrace, blobs),
 	}
 
-	// main
-	// pull a job from nats queue, try to get a lock from zookeeper,
-	// if fails drop the job
-	// else launch the job in a container, periodically do heartbeat to zookeeper
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
+	app.logger.Info("Starting the executor", zap.String("executor", cfg.executor), zap.Int("workers", app.config.workers))
+	app.serve(ctx)
+	app.logger.Info("Shutting down the executor")
+}
+
+// newExecutor returns the executor selected by the configuration
+func newExecutor(cfg config, logger *zap.Logger) (executor.Executor, error) {
+	switch cfg.executor {
+	case "docker":
+		return executor.NewDockerExecutor(logger)
+	case "sandbox":
+		return executor.NewSandboxExecutor(cfg.rootfs, "")
+	case "process":
+		// no isolation, for development hosts without a Docker daemon
+		return executor.NewProcessExecutor(""), nil
+	default:
+		return nil, fmt.Errorf("unknown executor %q", cfg.executor)
+	}
+}
+
+func openDB(cfg config) (*sql.DB, error) {
+	db, err := sql.Open("postgres", cfg.db.dsn)
+	if err != nil {
+		return nil, err
+	}
 
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(25)
+	duration, err := time.ParseDuration("15m")
+
+	if err != nil {
+		return nil, err
+	}
+	db.SetConnMaxIdleTime(duration)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
 }
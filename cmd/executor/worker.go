@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gertanoh.job-scheduler/internal/data"
+	"gertanoh.job-scheduler/internal/runner"
+	"gertanoh.job-scheduler/internal/ymlparser"
+	"go.uber.org/zap"
+)
+
+// heartbeatInterval is how often a running execution reports it is alive and
+// checks whether it was asked to stop. It must stay well below the lease of the
+// scheduler, which fails the executions without a recent heartbeat.
+const heartbeatInterval = 2 * time.Second
+
+// serve runs the workers until the context is cancelled
+func (app *application) serve(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < app.config.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			app.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// work claims executions from the job queue, highest priority first, and runs them one at a time
+func (app *application) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		item, err := app.models.ClaimExecution(ctx, app.config.agingInterval)
+		if err == nil {
+			app.runExecution(ctx, item)
+			continue
+		}
+
+		if !errors.Is(err, data.ErrRecordNotFound) {
+			app.logger.Error("Failed to claim an execution", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(app.config.pollInterval):
+		}
+	}
+}
+
+// runExecution runs the steps of a claimed execution, already running, and records its outcome
+func (app *application) runExecution(ctx context.Context, item *data.QueueItem) {
+	logger := app.logger.With(zap.Int64("job_id", item.JobID), zap.Int64("execution_id", item.ExecutionID))
+
+	execution, err := app.models.JobExecutions.Get(item.ExecutionID)
+	if err != nil {
+		app.finishExecution(logger, nil, &data.JobExecution{ID: item.ExecutionID}, data.ExecutionFailed, "failed to load execution: "+err.Error(), "")
+		return
+	}
+	logger = logger.With(zap.Int("attempt", execution.Attempt))
+
+	job, err := app.models.Jobs.Get(item.JobID)
+	if err != nil {
+		app.finishExecution(logger, nil, execution, data.ExecutionFailed, "failed to load job: "+err.Error(), "")
+		return
+	}
+
+	logs, err := app.createLogs(item.ExecutionID)
+	if err != nil {
+		app.finishExecution(logger, job, execution, data.ExecutionFailed, "failed to create logs: "+err.Error(), ymlparser.RetryOnError)
+		return
+	}
+	defer logs.Close()
+	published := app.publishLogs(logger, item.ExecutionID, logs)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var cancelRequested atomic.Bool
+	go app.heartbeat(runCtx, item.ExecutionID, func() {
+		cancelRequested.Store(true)
+		cancel()
+	})
+
+	logger.Info("Execution started")
+	run, err := app.runner.Run(runCtx, job.Job, published, func(result runner.StepResult) {
+		app.recordStep(logger, item.ExecutionID, result)
+	})
+	if run.Commit != "" {
+		if err := app.models.JobExecutions.SetCommit(item.ExecutionID, run.Commit); err != nil {
+			logger.Error("Failed to record commit", zap.String("commit", run.Commit), zap.Error(err))
+		}
+	}
+	app.recordArtifacts(logger, item.ExecutionID, run.Artifacts)
+	app.recordTests(logger, item.ExecutionID, run.Steps)
+	published.Close()
+	app.storeLogs(logger, item.ExecutionID, logs)
+
+	switch {
+	case cancelRequested.Load():
+		app.finishExecution(logger, job, execution, data.ExecutionCancelled, "", "")
+	case ctx.Err() != nil:
+		app.finishExecution(logger, job, execution, data.ExecutionFailed, "executor shut down during the execution", ymlparser.RetryOnError)
+	case errors.Is(err, runner.ErrTimedOut):
+		app.finishExecution(logger, job, execution, data.ExecutionTimedOut, err.Error(), ymlparser.RetryOnTimedOut)
+	case errors.Is(err, runner.ErrOOMKilled):
+		app.finishExecution(logger, job, execution, data.ExecutionOOMKilled, err.Error(), "")
+	case errors.Is(err, runner.ErrExecutor), errors.Is(err, runner.ErrCheckout), errors.Is(err, runner.ErrArtifacts):
+		app.finishExecution(logger, job, execution, data.ExecutionFailed, err.Error(), ymlparser.RetryOnError)
+	case err != nil:
+		app.finishExecution(logger, job, execution, data.ExecutionFailed, err.Error(), ymlparser.RetryOnFailed)
+	default:
+		app.finishExecution(logger, job, execution, data.ExecutionSucceeded, "", "")
+	}
+}
+
+// recordArtifacts stores the artifacts collected by the runner. Their content
+// is already in the blob store, a failure only loses track of it and is logged.
+func (app *application) recordArtifacts(logger *zap.Logger, executionID int64, artifacts []runner.Artifact) {
+	for _, artifact := range artifacts {
+		err := app.models.Artifacts.Insert(&data.ExecutionArtifact{
+			ExecutionID: executionID,
+			Path:        artifact.Path,
+			Size:        artifact.Size,
+			SHA256:      artifact.SHA256,
+			BlobKey:     artifact.Key,
+		})
+		if err != nil {
+			logger.Error("Failed to record artifact", zap.String("path", artifact.Path), zap.Error(err))
+		}
+	}
+}
+
+// recordTests stores the test results of the steps. A failure only loses the
+// results, which are still in the logs, and is logged.
+func (app *application) recordTests(logger *zap.Logger, executionID int64, steps []runner.StepResult) {
+	results := []*data.ExecutionTestResult{}
+	for _, step := range steps {
+		for _, test := range step.Tests {
+			results = append(results, &data.ExecutionTestResult{
+				ExecutionID: executionID,
+				Step:        step.Index,
+				Package:     test.Package,
+				Test:        test.Test,
+				Kind:        test.Kind(),
+				Status:      test.Status,
+				Elapsed:     test.Elapsed,
+				Output:      test.Output,
+			})
+		}
+	}
+	if len(results) == 0 {
+		return
+	}
+
+	if err := app.models.TestResults.InsertAll(executionID, results); err != nil {
+		logger.Error("Failed to record test results", zap.Int("results", len(results)), zap.Error(err))
+	}
+}
+
+// recordStep stores the state of a step reported by the runner. A failure is
+// only logged, it must not stop the execution.
+func (app *application) recordStep(logger *zap.Logger, executionID int64, result runner.StepResult) {
+	step := &data.ExecutionStep{
+		ExecutionID: executionID,
+		Index:       result.Index,
+		Name:        result.Name,
+		Status:      result.Status,
+		ExitCode:    result.ExitCode,
+		Duration:    result.Duration(),
+		LogOffset:   result.LogOffset,
+		LogLength:   result.LogLength,
+		Reason:      result.Reason,
+	}
+	if !result.StartedAt.IsZero() {
+		step.StartedAt = &result.StartedAt
+	}
+	if !result.FinishedAt.IsZero() {
+		step.FinishedAt = &result.FinishedAt
+	}
+
+	if err := app.models.Steps.Upsert(step); err != nil {
+		logger.Error("Failed to record step", zap.Int("step", result.Index), zap.String("status", result.Status), zap.Error(err))
+	}
+}
+
+// heartbeat renews the lease of a running execution and calls cancel once it
+// is flagged as cancelling, e.g. when a newer run replaces it or a user cancels
+// it, once it was deleted along with its job, or once the scheduler failed it
+// because the heartbeats stopped for longer than its lease.
+func (app *application) heartbeat(ctx context.Context, executionID int64, cancel func()) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			status, err := app.models.JobExecutions.Heartbeat(executionID)
+			if errors.Is(err, data.ErrRecordNotFound) {
+				cancel()
+				return
+			}
+			if err != nil {
+				app.logger.Error("Failed to send heartbeat", zap.Int64("execution_id", executionID), zap.Error(err))
+				continue
+			}
+			if status == data.ExecutionCancelling || data.IsFinalStatus(status) {
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// finishExecution records the final status of a running execution. An
+// execution failing with a kind of failure retried by the job's retry policy is
+// followed by a new attempt, queued in the same transaction and available once
+// the backoff delay elapsed. job is nil when it could not be loaded.
+func (app *application) finishExecution(logger *zap.Logger, job *data.Job, execution *data.JobExecution, status, reason, kind string) {
+	var retry *ymlparser.Retry
+	if job != nil {
+		retry = job.Retry
+	}
+	if !retry.Retries(kind, execution.Attempt) {
+		if err := app.models.JobExecutions.Transition(execution.ID, status, reason); err != nil {
+			logger.Error("Failed to record execution status", zap.String("status", status), zap.Error(err))
+			return
+		}
+		logger.Info("Execution finished", zap.String("status", status), zap.String("reason", reason))
+		return
+	}
+
+	firstAttempt := execution.ID
+	if execution.RetryOf != nil {
+		firstAttempt = *execution.RetryOf
+	}
+	delay := retry.Backoff(execution.Attempt)
+	next := &data.JobExecution{
+		JobID:         execution.JobID,
+		ExecutionTime: time.Now().Add(delay).UTC(),
+		Status:        data.ExecutionQueued,
+		Attempt:       execution.Attempt + 1,
+		RetryOf:       &firstAttempt,
+	}
+
+	err := app.models.Transaction(context.Background(), func(tx data.Models) error {
+		if err := tx.JobExecutions.Transition(execution.ID, status, reason); err != nil {
+			return err
+		}
+		if err := tx.JobExecutions.Insert(next); err != nil {
+			return err
+		}
+		return tx.Queue.Enqueue(&data.QueueItem{
+			ExecutionID: next.ID,
+			JobID:       next.JobID,
+			Priority:    job.Priority,
+			AvailableAt: next.ExecutionTime,
+		})
+	})
+	if err != nil {
+		logger.Error("Failed to record execution status", zap.String("status", status), zap.Error(err))
+		return
+	}
+	logger.Info("Execution finished, retry scheduled",
+		zap.String("status", status),
+		zap.String("reason", reason),
+		zap.Int64("retry_execution_id", next.ID),
+		zap.Int("retry_attempt", next.Attempt),
+		zap.Duration("backoff", delay))
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	_ "time/tzdata"
+
+	"gertanoh.job-scheduler/internal/data"
+	"gertanoh.job-scheduler/internal/scheduler"
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+type config struct {
+	env          string
+	pollInterval time.Duration
+	batchSize    int
+	lease        time.Duration
+	db           struct {
+		dsn string
+	}
+}
+
+// application config struct
+type application struct {
+	config config
+	logger *zap.Logger
+	models data.Models
+}
+
+func main() {
+
+	var cfg config
+
+	flag.StringVar(&cfg.env, "env", "dev", "Environment (dev|staging|prod)")
+	flag.StringVar(&cfg.db.dsn, "db-dsn", "", "PostgreSQL DSN")
+	flag.DurationVar(&cfg.pollInterval, "poll-interval", 5*time.Second, "Interval between two polls of the jobs schedule")
+	flag.IntVar(&cfg.batchSize, "batch-size", 100, "Maximum number of due jobs dispatched per transaction")
+	flag.DurationVar(&cfg.lease, "execution-lease", time.Minute, "Time a running execution stays running without a heartbeat from its executor")
+
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Fatalf("Failed to loav env vars %v", err)
+	}
+	logger := zap.Must(zap.NewProduction())
+	defer logger.Sync()
+
+	db, err := openDB(cfg)
+	if err != nil {
+		logger.Fatal("Fail to setup db", zap.Error(err))
+	}
+
+	defer db.Close()
+	logger.Info("DB connection setup")
+
+	app := &application{
+		config: cfg,
+		logger: logger,
+		models: data.NewModels(db),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	s := scheduler.New(app.models, app.logger, app.config.pollInterval, app.config.batchSize, app.config.lease)
+
+	app.logger.Info("Starting the scheduler", zap.Duration("poll_interval", app.config.pollInterval))
+	if err := s.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		app.logger.Error("Scheduler stopped", zap.Error(err))
+	}
+	app.logger.Info("Shutting down the scheduler")
+}
+
+func openDB(cfg config) (*sql.DB, error) {
+	db, err := sql.Open("postgres", cfg.db.dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(25)
+	duration, err := time.ParseDuration("15m")
+
+	if err != nil {
+		return nil, err
+	}
+	db.SetConnMaxIdleTime(duration)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
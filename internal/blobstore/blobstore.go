@@ -0,0 +1,100 @@
+// Package blobstore stores the blobs produced by the executions, like their
+// logs and artifacts, under slash separated keys.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned for keys without a blob
+	ErrNotFound = errors.New("blob not found")
+	// ErrURLNotSupported is returned by the stores that cannot hand out URLs
+	ErrURLNotSupported = errors.New("blob URLs are not supported by the store")
+)
+
+// Store is a blob storage backend. Blobs are written at once and not modified
+// afterwards, a Put replaces the whole blob.
+type Store interface {
+	// Put stores the content of r under key and returns its size. The content
+	// is streamed, r is not held in memory.
+	Put(ctx context.Context, key string, r io.Reader) (int64, error)
+	// Get returns the content of the blob stored under key
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// GetRange returns length bytes of the blob stored under key, starting at
+	// offset. A negative length reads up to the end of the blob.
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	// List returns the blobs whose key starts with prefix, sorted by key
+	List(ctx context.Context, prefix string) ([]Object, error)
+	// Delete removes the blob stored under key, a missing blob is not an error
+	Delete(ctx context.Context, key string) error
+	// URL returns a URL the blob can be downloaded from without credentials
+	// until expiry elapsed
+	URL(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// Object describes a stored blob
+type Object struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Config selects the backend of a store and configures it
+type Config struct {
+	// Backend is fs for a FileStore, s3 for an S3Store
+	Backend string
+	// Dir is the directory of the fs backend
+	Dir string
+	S3  S3Config
+}
+
+// New returns the store selected by the configuration. The URLs of a
+// filesystem store are signed by signer, they are not supported when nil.
+func New(cfg Config, signer *URLSigner) (Store, error) {
+	switch cfg.Backend {
+	case "fs":
+		return NewFileStore(cfg.Dir, signer)
+	case "s3":
+		return NewS3Store(cfg.S3)
+	default:
+		return nil, fmt.Errorf("unknown blob store %q", cfg.Backend)
+	}
+}
+
+// validateKey rejects the keys that are empty, absolute or have empty, . or ..
+// segments, so that they cannot escape the store of the filesystem backend.
+func validateKey(key string) error {
+	if key == "" {
+		return errors.New("empty key")
+	}
+	for _, segment := range strings.Split(key, "/") {
+		switch segment {
+		case "", ".", "..":
+			return fmt.Errorf("invalid key %q", key)
+		}
+	}
+	if strings.ContainsAny(key, "\\\x00") {
+		return fmt.Errorf("invalid key %q", key)
+	}
+	return nil
+}
+
+// validateRange rejects the ranges starting before the blob
+func validateRange(offset int64) error {
+	if offset < 0 {
+		return fmt.Errorf("invalid range offset %d", offset)
+	}
+	return nil
+}
+
+// readCloser closes c once done reading r, a part of it
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
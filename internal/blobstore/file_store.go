@@ -0,0 +1,212 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tmpPrefix starts the name of the files being written by Put
+const tmpPrefix = ".put-"
+
+// FileStore stores the blobs as files of a local directory, the key being
+// their path relative to it. The directory can be shared by several services
+// through a network filesystem.
+type FileStore struct {
+	dir    string
+	signer *URLSigner
+}
+
+var _ Store = (*FileStore)(nil)
+
+// NewFileStore instance creator, the directory is created if needed. The blob
+// URLs are signed by signer, to be served by the API; without a signer the
+// store does not support URLs.
+func NewFileStore(dir string, signer *URLSigner) (*FileStore, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %v", err)
+	}
+	return &FileStore{dir: dir, signer: signer}, nil
+}
+
+// Put writes the blob to a temporary file renamed once complete, so that
+// readers never see a partial blob.
+func (s *FileStore) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), tmpPrefix+"*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, contextReader{ctx: ctx, r: r})
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Get returns the file of the blob, which is an io.ReadSeeker
+func (s *FileStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.open(key)
+}
+
+func (s *FileStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := validateRange(offset); err != nil {
+		return nil, err
+	}
+	f, err := s.open(key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if length < 0 {
+		return f, nil
+	}
+	return readCloser{Reader: io.LimitReader(f, length), Closer: f}, nil
+}
+
+// List walks the directory of the prefix, the part of it up to its last slash
+func (s *FileStore) List(ctx context.Context, prefix string) ([]Object, error) {
+	root := s.dir
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		if err := validateKey(prefix[:i]); err != nil {
+			return nil, err
+		}
+		root = filepath.Join(s.dir, filepath.FromSlash(prefix[:i]))
+	}
+
+	objects := []Object{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), tmpPrefix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, Object{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+func (s *FileStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// URL returns a URL signed by the signer of the store, after checking the
+// blob exists
+func (s *FileStore) URL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	if s.signer == nil {
+		return "", ErrURLNotSupported
+	}
+	path, err := s.path(key)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	return s.signer.Sign(key, expiry), nil
+}
+
+// open opens the file of a key
+func (s *FileStore) open(key string) (*os.File, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// path returns the file of a key
+func (s *FileStore) path(key string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+// contextReader stops reading once the context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
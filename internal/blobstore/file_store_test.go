@@ -0,0 +1,167 @@
+package blobstore_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	. "gertanoh.job-scheduler/internal/blobstore"
+)
+
+// testStore runs the checks common to every backend
+func testStore(t *testing.T, store Store) {
+	t.Helper()
+	ctx := context.Background()
+
+	n, err := store.Put(ctx, "artifacts/report.xml", strings.NewReader("<testsuite/>"))
+	if err != nil {
+		t.Fatalf("Put() unexpected error: %v", err)
+	}
+	if n != 12 {
+		t.Errorf("Put() = %d, want 12", n)
+	}
+	for _, key := range []string{"logs/execution-1.log", "logs/execution-2.log", "logs/execution-10.log", "logs2/other"} {
+		if _, err := store.Put(ctx, key, strings.NewReader("line 1\nline 2\n")); err != nil {
+			t.Fatalf("Put(%s) unexpected error: %v", key, err)
+		}
+	}
+
+	r, err := store.Get(ctx, "artifacts/report.xml")
+	if err != nil {
+		t.Fatalf("Get() unexpected error: %v", err)
+	}
+	content, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(content) != "<testsuite/>" {
+		t.Errorf("Get() content = %q (%v), want %q", content, err, "<testsuite/>")
+	}
+
+	if _, err := store.Get(ctx, "artifacts/missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of a missing blob error = %v, want %v", err, ErrNotFound)
+	}
+
+	ranges := []struct {
+		offset, length int64
+		want           string
+	}{
+		{offset: 0, length: 6, want: "line 1"},
+		{offset: 7, length: -1, want: "line 2\n"},
+		{offset: 7, length: 100, want: "line 2\n"},
+		{offset: 3, length: 0, want: ""},
+		{offset: 100, length: -1, want: ""},
+	}
+	for _, rg := range ranges {
+		r, err := store.GetRange(ctx, "logs/execution-1.log", rg.offset, rg.length)
+		if err != nil {
+			t.Fatalf("GetRange(%d, %d) unexpected error: %v", rg.offset, rg.length, err)
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || string(content) != rg.want {
+			t.Errorf("GetRange(%d, %d) = %q (%v), want %q", rg.offset, rg.length, content, err, rg.want)
+		}
+	}
+	if _, err := store.GetRange(ctx, "logs/missing.log", 0, 10); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetRange() of a missing blob error = %v, want %v", err, ErrNotFound)
+	}
+
+	objects, err := store.List(ctx, "logs/")
+	if err != nil {
+		t.Fatalf("List() unexpected error: %v", err)
+	}
+	keys := []string{}
+	for _, object := range objects {
+		keys = append(keys, object.Key)
+		if object.Size != 14 {
+			t.Errorf("List() size of %s = %d, want 14", object.Key, object.Size)
+		}
+	}
+	if got, want := strings.Join(keys, ","), "logs/execution-1.log,logs/execution-10.log,logs/execution-2.log"; got != want {
+		t.Errorf("List(logs/) = %s, want %s", got, want)
+	}
+	if objects, err := store.List(ctx, "logs/execution-1"); err != nil || len(objects) != 2 {
+		t.Errorf("List(logs/execution-1) = %v (%v), want 2 blobs", objects, err)
+	}
+	if objects, err := store.List(ctx, "missing/"); err != nil || len(objects) != 0 {
+		t.Errorf("List(missing/) = %v (%v), want none", objects, err)
+	}
+
+	if err := store.Delete(ctx, "logs/execution-2.log"); err != nil {
+		t.Fatalf("Delete() unexpected error: %v", err)
+	}
+	if _, err := store.Get(ctx, "logs/execution-2.log"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of a deleted blob error = %v, want %v", err, ErrNotFound)
+	}
+	if err := store.Delete(ctx, "logs/execution-2.log"); err != nil {
+		t.Errorf("Delete() of a missing blob unexpected error: %v", err)
+	}
+
+	for _, key := range []string{"", "/etc/passwd", "../outside", "a//b", "a/./b"} {
+		if _, err := store.Put(ctx, key, strings.NewReader("x")); err == nil {
+			t.Errorf("Put(%q) expected an error", key)
+		}
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	signer := NewURLSigner("/blobs", []byte("secret"))
+	store, err := NewFileStore(t.TempDir(), signer)
+	if err != nil {
+		t.Fatalf("NewFileStore() unexpected error: %v", err)
+	}
+	testStore(t, store)
+
+	ctx := context.Background()
+	if _, err := store.URL(ctx, "artifacts/missing", time.Minute); !errors.Is(err, ErrNotFound) {
+		t.Errorf("URL() of a missing blob error = %v, want %v", err, ErrNotFound)
+	}
+
+	unsigned, err := NewFileStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := unsigned.URL(ctx, "artifacts/report.xml", time.Minute); !errors.Is(err, ErrURLNotSupported) {
+		t.Errorf("URL() without a signer error = %v, want %v", err, ErrURLNotSupported)
+	}
+}
+
+func TestURLSigner(t *testing.T) {
+	signer := NewURLSigner("/blobs/", []byte("secret"))
+	key := "artifacts/sha256/ab/report 1.xml"
+
+	signed := signer.Sign(key, time.Minute)
+	if !strings.HasPrefix(signed, "/blobs/artifacts/sha256/ab/report%201.xml?") {
+		t.Errorf("Sign() = %s, want the escaped key under /blobs", signed)
+	}
+
+	tests := []struct {
+		name    string
+		signer  *URLSigner
+		url     string
+		key     string
+		wantErr error
+	}{
+		{name: "Valid", signer: signer, url: signed, key: key},
+		{name: "Other key", signer: signer, url: signed, key: "artifacts/other", wantErr: ErrInvalidSignature},
+		{name: "Modified expiry", signer: signer, url: strings.Replace(signed, "expires=", "expires=1", 1), key: key, wantErr: ErrInvalidSignature},
+		{name: "Expired", signer: signer, url: signer.Sign(key, -time.Minute), key: key, wantErr: ErrURLExpired},
+		{name: "Other secret", signer: NewURLSigner("/blobs", []byte("other")), url: signed, key: key, wantErr: ErrInvalidSignature},
+		{name: "Unsigned", signer: signer, url: "/blobs/x?expires=99999999999", key: "x", wantErr: ErrInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.signer.Verify(tt.key, u.Query()); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
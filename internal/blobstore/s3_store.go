@@ -0,0 +1,350 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// s3PartSize is the size of the parts a blob is uploaded in, the minimum
+	// part size of S3. Smaller blobs are uploaded with a single request.
+	s3PartSize = 5 << 20
+	// s3MaxURLExpiry is the longest validity of a presigned URL
+	s3MaxURLExpiry = 7 * 24 * time.Hour
+)
+
+// S3Config locates the bucket of an S3Store and holds its credentials
+type S3Config struct {
+	// Endpoint is the URL of the S3 API, e.g. https://s3.eu-west-3.amazonaws.com
+	// or the URL of an S3 compatible server
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// S3Store stores the blobs as objects of a bucket of an S3 compatible API. The
+// bucket is addressed in the path of the requests, which every S3 compatible
+// server supports.
+type S3Store struct {
+	endpoint *url.URL
+	bucket   string
+	signer   signer
+	client   *http.Client
+	now      func() time.Time
+}
+
+var _ Store = (*S3Store)(nil)
+
+// NewS3Store instance creator, the bucket must exist
+func NewS3Store(cfg S3Config) (*S3Store, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Bucket == "" {
+		return nil, errors.New("missing S3 bucket")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+
+	return &S3Store{
+		endpoint: endpoint,
+		bucket:   cfg.Bucket,
+		signer:   signer{accessKeyID: cfg.AccessKeyID, secretAccessKey: cfg.SecretAccessKey, region: cfg.Region},
+		client:   &http.Client{},
+		now:      time.Now,
+	}, nil
+}
+
+// Put uploads a blob smaller than a part with a single request, and a larger
+// one with a multipart upload, holding a single part in memory at a time.
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	if err := validateKey(key); err != nil {
+		return 0, err
+	}
+
+	part := make([]byte, s3PartSize)
+	n, err := io.ReadFull(r, part)
+	switch {
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		resp, err := s.do(ctx, http.MethodPut, key, nil, nil, part[:n])
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return int64(n), nil
+	case err != nil:
+		return 0, err
+	}
+
+	return s.putMultipart(ctx, key, part, r)
+}
+
+// putMultipart uploads first and the rest of r as the parts of a multipart
+// upload, which is aborted on failure
+func (s *S3Store) putMultipart(ctx context.Context, key string, first []byte, r io.Reader) (int64, error) {
+	resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	var upload struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = decodeXML(resp, &upload)
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := s.uploadParts(ctx, key, upload.UploadID, first, r)
+	if err != nil {
+		// an upload left behind is billed until it is aborted
+		abortCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+		if resp, abortErr := s.do(abortCtx, http.MethodDelete, key, url.Values{"uploadId": {upload.UploadID}}, nil, nil); abortErr == nil {
+			resp.Body.Close()
+		}
+		return 0, err
+	}
+	return size, nil
+}
+
+func (s *S3Store) uploadParts(ctx context.Context, key, uploadID string, part []byte, r io.Reader) (int64, error) {
+	type completedPart struct {
+		PartNumber int
+		ETag       string
+	}
+	var complete struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}
+
+	var size int64
+	for number := 1; len(part) > 0; number++ {
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+		resp, err := s.do(ctx, http.MethodPut, key, query, nil, part)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		complete.Parts = append(complete.Parts, completedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+		size += int64(len(part))
+
+		n, err := io.ReadFull(r, part[:cap(part)])
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, err
+		}
+		part = part[:n]
+	}
+
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, nil, body)
+	if err != nil {
+		return 0, err
+	}
+	// the completion can fail after a 200 status, with an error document
+	var result struct {
+		XMLName xml.Name
+		Code    string
+		Message string
+	}
+	if err := decodeXML(resp, &result); err != nil {
+		return 0, err
+	}
+	if result.XMLName.Local == "Error" {
+		return 0, fmt.Errorf("S3 error %s: %s", result.Code, result.Message)
+	}
+	return size, nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.GetRange(ctx, key, 0, -1)
+}
+
+func (s *S3Store) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+	if err := validateRange(offset); err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	switch {
+	case length == 0:
+		// S3 has no empty ranges
+		resp, err := s.do(ctx, http.MethodHead, key, nil, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		return io.NopCloser(strings.NewReader("")), nil
+	case length > 0:
+		header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	case offset > 0:
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := s.do(ctx, http.MethodGet, key, nil, header, nil)
+	if err != nil {
+		var s3Err *s3Error
+		if errors.As(err, &s3Err) && s3Err.status == http.StatusRequestedRangeNotSatisfiable {
+			// like reading a file past its end
+			return io.NopCloser(strings.NewReader("")), nil
+		}
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// List pages through the objects of the bucket with ListObjectsV2
+func (s *S3Store) List(ctx context.Context, prefix string) ([]Object, error) {
+	objects := []Object{}
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			Contents []struct {
+				Key          string
+				Size         int64
+				LastModified time.Time
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		if err := decodeXML(resp, &result); err != nil {
+			return nil, err
+		}
+		for _, content := range result.Contents {
+			objects = append(objects, Object{Key: content.Key, Size: content.Size, ModTime: content.LastModified})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// URL returns a presigned URL of the object, S3 limits their validity to a week
+func (s *S3Store) URL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	if expiry <= 0 || expiry > s3MaxURLExpiry {
+		return "", fmt.Errorf("URL expiry must be between 1s and %s", s3MaxURLExpiry)
+	}
+	return s.signer.presign(s.url(key, nil), s.now(), expiry).String(), nil
+}
+
+// do sends a signed request for an object, or for the bucket when key is
+// empty. Statuses other than 2xx are returned as errors, ErrNotFound for 404.
+func (s *S3Store) do(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := s.url(key, query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	// keep the path encoded as it was signed
+	req.URL = u
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	payloadHash := emptyPayloadHash
+	if len(body) > 0 {
+		payloadHash = hashHex(body)
+	}
+	s.signer.sign(req, payloadHash, s.now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	s3Err := &s3Error{status: resp.StatusCode}
+	if method != http.MethodHead {
+		// the error document is informative only
+		_ = xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(s3Err)
+	}
+	if resp.StatusCode == http.StatusNotFound && s3Err.Code != "NoSuchBucket" {
+		return nil, ErrNotFound
+	}
+	return nil, s3Err
+}
+
+// url returns the URL of an object, or of the bucket when key is empty
+func (s *S3Store) url(key string, query url.Values) *url.URL {
+	u := *s.endpoint
+	path := strings.TrimSuffix(u.Path, "/") + "/" + s.bucket
+	if key != "" {
+		path += "/" + key
+	}
+	setPath(&u, path)
+	u.RawQuery = canonicalQuery(query)
+	return &u
+}
+
+// s3Error is the error document of a failed request
+type s3Error struct {
+	status  int
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (e *s3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("S3 request failed with status %d", e.status)
+	}
+	return fmt.Sprintf("S3 error %s (status %d): %s", e.Code, e.status, e.Message)
+}
+
+// decodeXML decodes the body of a response and closes it
+func decodeXML(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	if err := xml.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode S3 response: %v", err)
+	}
+	return nil
+}
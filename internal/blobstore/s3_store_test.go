@@ -0,0 +1,220 @@
+package blobstore_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "gertanoh.job-scheduler/internal/blobstore"
+)
+
+// fakeS3 is a local stand-in for the subset of the S3 API used by S3Store,
+// with path style addressing and a single bucket. It checks that requests are
+// signed but not their signature, which is covered by the AWS examples.
+type fakeS3 struct {
+	t      *testing.T
+	bucket string
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+	// parts counts the uploaded parts
+	parts int
+}
+
+func newFakeS3(t *testing.T, bucket string) *httptest.Server {
+	fake := &fakeS3{t: t, bucket: bucket, objects: map[string][]byte{}, uploads: map[string]map[int][]byte{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Query().Get("X-Amz-Signature") == "" && !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test-key/") {
+		f.error(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	bucket, key, _ := strings.Cut(path, "/")
+	if bucket != f.bucket {
+		f.error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	if hash := r.Header.Get("X-Amz-Content-Sha256"); hash != "" {
+		sum := sha256.Sum256(body)
+		if hash != hex.EncodeToString(sum[:]) {
+			f.error(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch")
+			return
+		}
+	}
+
+	query := r.URL.Query()
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		f.list(w, query.Get("prefix"), query.Get("continuation-token"))
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		id := strconv.Itoa(len(f.uploads) + 1)
+		f.uploads[id] = map[int][]byte{}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		f.uploads[query.Get("uploadId")][number] = body
+		f.parts++
+		w.Header().Set("ETag", fmt.Sprintf("%q", strconv.Itoa(number)))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		var complete struct {
+			Parts []struct{ PartNumber int } `xml:"Part"`
+		}
+		if err := xml.Unmarshal(body, &complete); err != nil {
+			f.error(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		var content []byte
+		for _, part := range complete.Parts {
+			content = append(content, f.uploads[query.Get("uploadId")][part.PartNumber]...)
+		}
+		f.objects[key] = content
+		delete(f.uploads, query.Get("uploadId"))
+		fmt.Fprint(w, "<CompleteMultipartUploadResult/>")
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		f.objects[key] = body
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		content, ok := f.objects[key]
+		if !ok {
+			f.error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		http.ServeContent(w, r, key, time.Time{}, bytes.NewReader(content))
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		f.error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// list returns the objects of the bucket by pages of two
+func (f *fakeS3) list(w http.ResponseWriter, prefix, token string) {
+	keys := []string{}
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) && key > token {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	fmt.Fprint(w, "<ListBucketResult>")
+	if len(keys) > 2 {
+		keys = keys[:2]
+		fmt.Fprintf(w, "<IsTruncated>true</IsTruncated><NextContinuationToken>%s</NextContinuationToken>", keys[1])
+	}
+	for _, key := range keys {
+		fmt.Fprintf(w, "<Contents><Key>%s</Key><Size>%d</Size><LastModified>2024-02-24T21:09:02.000Z</LastModified></Contents>",
+			key, len(f.objects[key]))
+	}
+	fmt.Fprint(w, "</ListBucketResult>")
+}
+
+func (f *fakeS3) error(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func TestS3Store(t *testing.T) {
+	server := newFakeS3(t, "blobs")
+	store, err := NewS3Store(S3Config{
+		Endpoint:        server.URL,
+		Bucket:          "blobs",
+		AccessKeyID:     "test-key",
+		SecretAccessKey: "test-secret",
+	})
+	if err != nil {
+		t.Fatalf("NewS3Store() unexpected error: %v", err)
+	}
+	testStore(t, store)
+
+	ctx := context.Background()
+	large := bytes.Repeat([]byte("0123456789abcdef"), 800_000)
+	n, err := store.Put(ctx, "logs/large.log", bytes.NewReader(large))
+	if err != nil {
+		t.Fatalf("Put() of a multipart blob unexpected error: %v", err)
+	}
+	if n != int64(len(large)) {
+		t.Errorf("Put() = %d, want %d", n, len(large))
+	}
+	r, err := store.GetRange(ctx, "logs/large.log", 5<<20-2, 4)
+	if err != nil {
+		t.Fatalf("GetRange() unexpected error: %v", err)
+	}
+	content, _ := io.ReadAll(r)
+	r.Close()
+	if want := large[5<<20-2 : 5<<20+2]; !bytes.Equal(content, want) {
+		t.Errorf("GetRange() across parts = %q, want %q", content, want)
+	}
+
+	url, err := store.URL(ctx, "artifacts/report.xml", time.Minute)
+	if err != nil {
+		t.Fatalf("URL() unexpected error: %v", err)
+	}
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s unexpected error: %v", url, err)
+	}
+	content, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(content) != "<testsuite/>" {
+		t.Errorf("GET presigned URL = %d %q, want 200 %q", resp.StatusCode, content, "<testsuite/>")
+	}
+
+	missing, err := NewS3Store(S3Config{Endpoint: server.URL, Bucket: "missing", AccessKeyID: "test-key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := missing.Get(ctx, "artifacts/report.xml"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() from a missing bucket error = %v, want a NoSuchBucket error", err)
+	}
+}
+
+func TestNewS3Store(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  S3Config
+	}{
+		{name: "Missing bucket", cfg: S3Config{Endpoint: "http://localhost:9000"}},
+		{name: "Missing endpoint", cfg: S3Config{Bucket: "blobs"}},
+		{name: "Endpoint without scheme", cfg: S3Config{Endpoint: "localhost:9000", Bucket: "blobs"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewS3Store(tt.cfg); err == nil {
+				t.Errorf("NewS3Store() expected an error")
+			}
+		})
+	}
+}
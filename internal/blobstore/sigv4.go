@@ -0,0 +1,166 @@
+package blobstore
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Requests to S3 are authenticated with the AWS Signature Version 4, see
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-authenticating-requests.html
+
+const (
+	sigAlgorithm = "AWS4-HMAC-SHA256"
+	sigService   = "s3"
+	amzDate      = "20060102T150405Z"
+	// unsignedPayload replaces the payload hash of presigned URLs
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// emptyPayloadHash is the SHA-256 of an empty payload
+var emptyPayloadHash = hashHex(nil)
+
+// signer signs the requests of a key pair for a region
+type signer struct {
+	accessKeyID     string
+	secretAccessKey string
+	region          string
+}
+
+// sign adds the Authorization header of a request whose payload hashes to
+// payloadHash, along with the x-amz-date and x-amz-content-sha256 headers.
+// The request path must be set by setPath.
+func (s signer) sign(req *http.Request, payloadHash string, t time.Time) {
+	t = t.UTC()
+	req.Header.Set("X-Amz-Date", t.Format(amzDate))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	names := []string{"host"}
+	headers := map[string]string{"host": requestHost(req)}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		names = append(names, name)
+		headers[name] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	signature := s.signature(t, req.Method, req.URL, canonicalHeaders.String(), signedHeaders, payloadHash)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigAlgorithm, s.accessKeyID, s.scope(t), signedHeaders, signature))
+}
+
+// presign returns u with the query parameters authenticating a GET request
+// until expiry elapsed. The path of u must be set by setPath.
+func (s signer) presign(u *url.URL, t time.Time, expiry time.Duration) *url.URL {
+	t = t.UTC()
+	query := u.Query()
+	query.Set("X-Amz-Algorithm", sigAlgorithm)
+	query.Set("X-Amz-Credential", s.accessKeyID+"/"+s.scope(t))
+	query.Set("X-Amz-Date", t.Format(amzDate))
+	query.Set("X-Amz-Expires", strconv.FormatInt(int64(expiry/time.Second), 10))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	signed := *u
+	signed.RawQuery = canonicalQuery(query)
+	signature := s.signature(t, http.MethodGet, &signed, "host:"+u.Host+"\n", "host", unsignedPayload)
+	signed.RawQuery += "&X-Amz-Signature=" + signature
+	return &signed
+}
+
+// signature computes the signature of a canonical request
+func (s signer) signature(t time.Time, method string, u *url.URL, canonicalHeaders, signedHeaders, payloadHash string) string {
+	query, _ := url.ParseQuery(u.RawQuery)
+	canonicalRequest := strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		canonicalQuery(query),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		sigAlgorithm,
+		t.Format(amzDate),
+		s.scope(t),
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretAccessKey), t.Format("20060102"))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, sigService)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func (s signer) scope(t time.Time) string {
+	return t.Format("20060102") + "/" + s.region + "/" + sigService + "/aws4_request"
+}
+
+// setPath sets the path of u, encoded the way the canonical request expects it
+func setPath(u *url.URL, path string) {
+	u.Path = path
+	u.RawPath = uriEncode(path, false)
+}
+
+// canonicalQuery encodes the query parameters sorted by name, then value
+func canonicalQuery(query url.Values) string {
+	params := []string{}
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, uriEncode(name, true)+"="+uriEncode(value, true))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// uriEncode percent-encodes every byte but the unreserved characters, and the
+// slashes unless encodeSlash is set
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func requestHost(req *http.Request) string {
+	if req.Host != "" {
+		return req.Host
+	}
+	return req.URL.Host
+}
+
+func hashHex(p []byte) string {
+	sum := sha256.Sum256(p)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
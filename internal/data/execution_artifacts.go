@@ -0,0 +1,115 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type ExecutionArtifactModel struct {
+	DB DBTX
+}
+
+// ExecutionArtifact is a file kept from the workspace of an execution, its
+// content is stored in the blob store under BlobKey.
+type ExecutionArtifact struct {
+	ID          int64     `json:"id"`
+	ExecutionID int64     `json:"execution_id"`
+	Path        string    `json:"path"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	BlobKey     string    `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Insert records an artifact, replacing the one of the execution with the same path
+func (m ExecutionArtifactModel) Insert(artifact *ExecutionArtifact) error {
+	query := `
+		INSERT INTO execution_artifacts (execution_id, path, size, sha256, blob_key)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (execution_id, path) DO UPDATE
+		SET size = EXCLUDED.size, sha256 = EXCLUDED.sha256, blob_key = EXCLUDED.blob_key
+		RETURNING id, created_at`
+
+	args := []interface{}{artifact.ExecutionID, artifact.Path, artifact.Size, artifact.SHA256, artifact.BlobKey}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&artifact.ID, &artifact.CreatedAt)
+}
+
+// Get returns an artifact of an execution
+func (m ExecutionArtifactModel) Get(executionID, id int64) (*ExecutionArtifact, error) {
+	query := `
+		SELECT id, execution_id, path, size, sha256, blob_key, created_at
+		FROM execution_artifacts
+		WHERE execution_id = $1 AND id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var artifact ExecutionArtifact
+	err := m.DB.QueryRowContext(ctx, query, executionID, id).Scan(
+		&artifact.ID,
+		&artifact.ExecutionID,
+		&artifact.Path,
+		&artifact.Size,
+		&artifact.SHA256,
+		&artifact.BlobKey,
+		&artifact.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &artifact, nil
+}
+
+// GetAllForExecution returns the artifacts of an execution sorted by path
+func (m ExecutionArtifactModel) GetAllForExecution(executionID int64) ([]*ExecutionArtifact, error) {
+	query := `
+		SELECT id, execution_id, path, size, sha256, blob_key, created_at
+		FROM execution_artifacts
+		WHERE execution_id = $1
+		ORDER BY path`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, executionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	artifacts := []*ExecutionArtifact{}
+	for rows.Next() {
+		var artifact ExecutionArtifact
+		err := rows.Scan(
+			&artifact.ID,
+			&artifact.ExecutionID,
+			&artifact.Path,
+			&artifact.Size,
+			&artifact.SHA256,
+			&artifact.BlobKey,
+			&artifact.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, &artifact)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return artifacts, nil
+}
@@ -0,0 +1,97 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+type ExecutionStepModel struct {
+	DB DBTX
+}
+
+// ExecutionStep is the outcome of a step of an execution. Its output is the
+// slice of the execution logs starting at LogOffset, LogLength bytes long.
+type ExecutionStep struct {
+	ID          int64         `json:"-"`
+	ExecutionID int64         `json:"execution_id"`
+	Index       int           `json:"index"`
+	Name        string        `json:"name"`
+	Status      string        `json:"status"`
+	ExitCode    *int          `json:"exit_code"`
+	StartedAt   *time.Time    `json:"started_at,omitempty"`
+	FinishedAt  *time.Time    `json:"finished_at,omitempty"`
+	Duration    time.Duration `json:"duration"`
+	LogOffset   int64         `json:"log_offset"`
+	LogLength   int64         `json:"log_length"`
+	Reason      string        `json:"reason,omitempty"`
+}
+
+// Upsert records the state of a step, identified by its execution and index
+func (m ExecutionStepModel) Upsert(step *ExecutionStep) error {
+	query := `
+		INSERT INTO execution_steps (execution_id, step_index, name, status, exit_code, started_at,
+			finished_at, duration, log_offset, log_length, reason)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, ''))
+		ON CONFLICT (execution_id, step_index) DO UPDATE
+		SET name = EXCLUDED.name, status = EXCLUDED.status, exit_code = EXCLUDED.exit_code,
+			started_at = EXCLUDED.started_at, finished_at = EXCLUDED.finished_at,
+			duration = EXCLUDED.duration, log_offset = EXCLUDED.log_offset,
+			log_length = EXCLUDED.log_length, reason = EXCLUDED.reason
+		RETURNING id`
+
+	args := []interface{}{step.ExecutionID, step.Index, step.Name, step.Status, step.ExitCode, step.StartedAt,
+		step.FinishedAt, step.Duration, step.LogOffset, step.LogLength, step.Reason}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&step.ID)
+}
+
+// GetAllForExecution returns the steps of an execution in order
+func (m ExecutionStepModel) GetAllForExecution(executionID int64) ([]*ExecutionStep, error) {
+	query := `
+		SELECT id, execution_id, step_index, name, status, exit_code, started_at, finished_at,
+			duration, log_offset, log_length, COALESCE(reason, '')
+		FROM execution_steps
+		WHERE execution_id = $1
+		ORDER BY step_index`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, executionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	steps := []*ExecutionStep{}
+	for rows.Next() {
+		var step ExecutionStep
+		err := rows.Scan(
+			&step.ID,
+			&step.ExecutionID,
+			&step.Index,
+			&step.Name,
+			&step.Status,
+			&step.ExitCode,
+			&step.StartedAt,
+			&step.FinishedAt,
+			&step.Duration,
+			&step.LogOffset,
+			&step.LogLength,
+			&step.Reason,
+		)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, &step)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return steps, nil
+}
@@ -0,0 +1,204 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// testResultsBatchSize is the number of test results inserted by a statement
+const testResultsBatchSize = 1000
+
+type ExecutionTestResultModel struct {
+	DB DBTX
+}
+
+// ExecutionTestResult is the outcome of a package, a test or a subtest run by
+// a step of an execution with go test -json
+type ExecutionTestResult struct {
+	ID          int64  `json:"-"`
+	ExecutionID int64  `json:"execution_id"`
+	Step        int    `json:"step"`
+	Package     string `json:"package"`
+	// Test is empty for the result of a package, TestName/subtest for a subtest
+	Test    string        `json:"test,omitempty"`
+	Kind    string        `json:"kind"`
+	Status  string        `json:"status"`
+	Elapsed time.Duration `json:"elapsed"`
+	// Output is the end of the output of a failed result
+	Output    string    `json:"output,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// InsertAll records the test results of an execution, replacing the ones of
+// the same step, package and test. They are inserted by batches.
+func (m ExecutionTestResultModel) InsertAll(executionID int64, results []*ExecutionTestResult) error {
+	query := `
+		INSERT INTO execution_test_results (execution_id, step_index, package, test, kind, status, elapsed, output)
+		SELECT $1, r.step_index, r.package, r.test, r.kind, r.status, r.elapsed, NULLIF(r.output, '')
+		FROM unnest($2::integer[], $3::text[], $4::text[], $5::text[], $6::text[], $7::bigint[], $8::text[])
+			AS r(step_index, package, test, kind, status, elapsed, output)
+		ON CONFLICT (execution_id, step_index, package, test) DO UPDATE
+		SET kind = EXCLUDED.kind, status = EXCLUDED.status, elapsed = EXCLUDED.elapsed, output = EXCLUDED.output`
+
+	for start := 0; start < len(results); start += testResultsBatchSize {
+		batch := results[start:min(start+testResultsBatchSize, len(results))]
+
+		steps := make([]int64, len(batch))
+		packages := make([]string, len(batch))
+		tests := make([]string, len(batch))
+		kinds := make([]string, len(batch))
+		statuses := make([]string, len(batch))
+		elapsed := make([]int64, len(batch))
+		outputs := make([]string, len(batch))
+		for i, r := range batch {
+			steps[i], packages[i], tests[i], kinds[i] = int64(r.Step), r.Package, r.Test, r.Kind
+			statuses[i], elapsed[i], outputs[i] = r.Status, int64(r.Elapsed), r.Output
+		}
+
+		args := []interface{}{executionID, pq.Array(steps), pq.Array(packages), pq.Array(tests), pq.Array(kinds),
+			pq.Array(statuses), pq.Array(elapsed), pq.Array(outputs)}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		_, err := m.DB.ExecContext(ctx, query, args...)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAllForExecution returns the test results of an execution, the failures
+// first, then sorted by step, package and test
+func (m ExecutionTestResultModel) GetAllForExecution(executionID int64) ([]*ExecutionTestResult, error) {
+	query := `
+		SELECT id, execution_id, step_index, package, test, kind, status, elapsed, COALESCE(output, ''), created_at
+		FROM execution_test_results
+		WHERE execution_id = $1
+		ORDER BY status = 'fail' DESC, step_index, package, test`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, executionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []*ExecutionTestResult{}
+	for rows.Next() {
+		var result ExecutionTestResult
+		err := rows.Scan(
+			&result.ID,
+			&result.ExecutionID,
+			&result.Step,
+			&result.Package,
+			&result.Test,
+			&result.Kind,
+			&result.Status,
+			&result.Elapsed,
+			&result.Output,
+			&result.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, &result)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// FlakyTest is a test that both passed and failed on the same commit in the
+// recent executions of a job
+type FlakyTest struct {
+	Package string `json:"package"`
+	Test    string `json:"test"`
+	// Score is the share of the runs of the test following a run on the same
+	// commit whose status differs from it, from 0 to 1
+	Score float64 `json:"score"`
+	// Runs and Failures count the runs of the test that passed or failed
+	Runs     int `json:"runs"`
+	Failures int `json:"failures"`
+	// Flips counts the runs whose status differs from the previous run on the same commit
+	Flips        int `json:"flips"`
+	FlakyCommits int `json:"flaky_commits"`
+	// FirstSeen and LastSeen are the times of the executions of the first and last flips
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// GetFlakyForJob returns the tests and subtests that flipped between pass and
+// fail on the same commit in the last finished executions of a job with a
+// commit, the flakiest first
+func (m ExecutionTestResultModel) GetFlakyForJob(jobID int64, executions int) ([]*FlakyTest, error) {
+	query := `
+		WITH executions AS (
+			SELECT id, commit_sha, COALESCE(started_at, execution_time) AS executed_at
+			FROM job_executions
+			WHERE job_id = $1 AND status = ANY($3)
+			AND commit_sha IS NOT NULL AND commit_sha <> ''
+			ORDER BY execution_time DESC, id DESC
+			LIMIT $2
+		), runs AS (
+			SELECT r.package, r.test, r.status, e.commit_sha, e.executed_at,
+				LAG(r.status) OVER (PARTITION BY r.package, r.test, e.commit_sha ORDER BY e.executed_at, e.id, r.step_index) AS previous
+			FROM execution_test_results r
+			JOIN executions e ON e.id = r.execution_id
+			WHERE r.kind <> 'package' AND r.status IN ('pass', 'fail')
+		)
+		SELECT package, test,
+			ROUND(COUNT(*) FILTER (WHERE status <> previous)::numeric / COUNT(previous), 3)::float8 AS score,
+			COUNT(*) AS run_count,
+			COUNT(*) FILTER (WHERE status = 'fail') AS failures,
+			COUNT(*) FILTER (WHERE status <> previous) AS flips,
+			COUNT(DISTINCT commit_sha) FILTER (WHERE status <> previous) AS flaky_commits,
+			MIN(executed_at) FILTER (WHERE status <> previous) AS first_seen,
+			MAX(executed_at) FILTER (WHERE status <> previous) AS last_seen
+		FROM runs
+		GROUP BY package, test
+		HAVING COUNT(*) FILTER (WHERE status <> previous) > 0
+		ORDER BY score DESC, flips DESC, package, test`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, jobID, executions, pq.Array(FinishedExecutionStatuses))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tests := []*FlakyTest{}
+	for rows.Next() {
+		var test FlakyTest
+		err := rows.Scan(
+			&test.Package,
+			&test.Test,
+			&test.Score,
+			&test.Runs,
+			&test.Failures,
+			&test.Flips,
+			&test.FlakyCommits,
+			&test.FirstSeen,
+			&test.LastSeen,
+		)
+		if err != nil {
+			return nil, err
+		}
+		tests = append(tests, &test)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tests, nil
+}
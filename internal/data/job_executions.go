@@ -0,0 +1,547 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"gertanoh.job-scheduler/internal/validator"
+	"github.com/lib/pq"
+)
+
+// ErrInvalidTransition is returned when an execution is asked to move to a
+// status it cannot reach from its current one.
+var ErrInvalidTransition = errors.New("invalid execution status transition")
+
+const (
+	ExecutionQueued = "queued"
+	// ExecutionSkippedMisfire marks a run missed while the scheduler was down
+	// and dropped by the job's misfire policy.
+	ExecutionSkippedMisfire = "skipped_misfire"
+	// ExecutionSkipped marks a run that was not started, the reason column says why.
+	ExecutionSkipped    = "skipped"
+	ExecutionRunning    = "running"
+	ExecutionSucceeded  = "succeeded"
+	ExecutionFailed     = "failed"
+	ExecutionCancelling = "cancelling"
+	ExecutionCancelled  = "cancelled"
+	ExecutionTimedOut   = "timed_out"
+	// ExecutionOOMKilled marks a run failed by a step exceeding the memory limit of the job.
+	ExecutionOOMKilled = "oom_killed"
+)
+
+// ExecutionStatuses lists every status an execution can have
+var ExecutionStatuses = []string{
+	ExecutionQueued, ExecutionRunning, ExecutionCancelling,
+	ExecutionSucceeded, ExecutionFailed, ExecutionCancelled, ExecutionTimedOut, ExecutionOOMKilled,
+	ExecutionSkipped, ExecutionSkippedMisfire,
+}
+
+// ActiveExecutionStatuses are the statuses of an execution that is waiting to run or running.
+var ActiveExecutionStatuses = []string{ExecutionQueued, ExecutionRunning, ExecutionCancelling}
+
+// FinishedExecutionStatuses are the final statuses of an execution that was run,
+// unlike the skipped ones
+var FinishedExecutionStatuses = []string{
+	ExecutionSucceeded, ExecutionFailed, ExecutionCancelled, ExecutionTimedOut, ExecutionOOMKilled,
+}
+
+// executionTransitions lists the statuses reachable from each status.
+// Statuses missing from the map are final.
+var executionTransitions = map[string][]string{
+	ExecutionQueued:     {ExecutionRunning, ExecutionCancelled},
+	ExecutionRunning:    {ExecutionSucceeded, ExecutionFailed, ExecutionCancelling, ExecutionTimedOut, ExecutionOOMKilled},
+	ExecutionCancelling: {ExecutionCancelled, ExecutionSucceeded, ExecutionFailed, ExecutionTimedOut, ExecutionOOMKilled},
+}
+
+// CanTransition reports whether an execution can move from one status to another
+func CanTransition(from, to string) bool {
+	return validator.PermittedValue(to, executionTransitions[from]...)
+}
+
+// IsFinalStatus reports whether an execution with this status will not change anymore
+func IsFinalStatus(status string) bool {
+	_, ok := executionTransitions[status]
+	return !ok
+}
+
+// previousStatuses returns the statuses an execution can move to status from
+func previousStatuses(status string) []string {
+	from := []string{}
+	for s := range executionTransitions {
+		if CanTransition(s, status) {
+			from = append(from, s)
+		}
+	}
+	return from
+}
+
+type JobExecutionModel struct {
+	DB DBTX
+}
+
+type JobExecution struct {
+	ID             int64      `json:"id"`
+	JobID          int64      `json:"job_id"`
+	ExecutionTime  time.Time  `json:"execution_time"`
+	Status         string     `json:"status"`
+	Reason         string     `json:"reason,omitempty"`
+	StartedAt      *time.Time `json:"started_at,omitempty"`
+	FinishedAt     *time.Time `json:"finished_at,omitempty"`
+	LastUpdateTime time.Time  `json:"last_update_time"`
+	LogsPath       string     `json:"logs_path,omitempty"`
+	// Attempt counts the attempts of a run from 1, RetryOf is the id of its
+	// first attempt for the retries.
+	Attempt int    `json:"attempt"`
+	RetryOf *int64 `json:"retry_of,omitempty"`
+	// CommitSHA is the commit checked out for the jobs with a source
+	CommitSHA string `json:"commit_sha,omitempty"`
+	// HeartbeatAt is the last time the executor running the execution reported it was alive
+	HeartbeatAt *time.Time `json:"heartbeat_at,omitempty"`
+}
+
+const executionColumns = `id, job_id, execution_time, status, COALESCE(reason, ''), started_at, finished_at,
+		last_update_time, COALESCE(logs_path, ''), attempt, retry_of, COALESCE(commit_sha, ''), heartbeat_at`
+
+// LeaseExpired reports whether the executor running an execution stopped
+// sending heartbeats for longer than the lease, e.g. because it died after
+// claiming it. Queued executions are still in the job queue and never expire.
+func (e *JobExecution) LeaseExpired(now time.Time, lease time.Duration) bool {
+	if e.Status != ExecutionRunning && e.Status != ExecutionCancelling {
+		return false
+	}
+	heartbeat := e.LastUpdateTime
+	if e.HeartbeatAt != nil {
+		heartbeat = *e.HeartbeatAt
+	}
+	return now.Sub(heartbeat) > lease
+}
+
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanExecution(row scanner, extra ...interface{}) (*JobExecution, error) {
+	var execution JobExecution
+	dest := append(extra,
+		&execution.ID,
+		&execution.JobID,
+		&execution.ExecutionTime,
+		&execution.Status,
+		&execution.Reason,
+		&execution.StartedAt,
+		&execution.FinishedAt,
+		&execution.LastUpdateTime,
+		&execution.LogsPath,
+		&execution.Attempt,
+		&execution.RetryOf,
+		&execution.CommitSHA,
+		&execution.HeartbeatAt,
+	)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	return &execution, nil
+}
+
+func ValidateExecutionStatus(v *validator.Validator, status string) {
+	v.Check(status == "" || validator.PermittedValue(status, ExecutionStatuses...), "status", "unknown execution status")
+}
+
+// Insert records an execution, as the first attempt of its run unless Attempt is set.
+func (e JobExecutionModel) Insert(execution *JobExecution) error {
+	if execution.Attempt == 0 {
+		execution.Attempt = 1
+	}
+
+	query := `
+		INSERT INTO job_executions (job_id, execution_time, status, reason, attempt, retry_of)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6)
+		RETURNING id, last_update_time`
+
+	args := []interface{}{execution.JobID, execution.ExecutionTime, execution.Status, execution.Reason,
+		execution.Attempt, execution.RetryOf}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return e.DB.QueryRowContext(ctx, query, args...).Scan(&execution.ID, &execution.LastUpdateTime)
+}
+
+// ownedBy restricts a query on job_executions to the executions of the jobs of
+// the user given as the numbered parameter.
+func ownedBy(param int) string {
+	return fmt.Sprintf("job_id IN (SELECT id FROM jobs WHERE user_id = $%d)", param)
+}
+
+// Get returns an execution regardless of the owner of its job, for the
+// services. Requests made by a user go through GetForUser.
+func (e JobExecutionModel) Get(id int64) (*JobExecution, error) {
+	return e.get(id, "", false)
+}
+
+// GetForUser returns an execution of a job owned by the user. ErrRecordNotFound
+// is returned for the executions of other users.
+func (e JobExecutionModel) GetForUser(id int64, userID string) (*JobExecution, error) {
+	return e.get(id, userID, true)
+}
+
+func (e JobExecutionModel) get(id int64, userID string, scoped bool) (*JobExecution, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + executionColumns + `
+		FROM job_executions
+		WHERE id = $1
+		AND (` + ownedBy(2) + ` OR NOT $3)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	execution, err := scanExecution(e.DB.QueryRowContext(ctx, query, id, userID, scoped))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return execution, nil
+}
+
+// GetLatestForJob returns the execution of a job owned by the user with the most recent execution time
+func (e JobExecutionModel) GetLatestForJob(jobID int64, userID string) (*JobExecution, error) {
+	query := `
+		SELECT ` + executionColumns + `
+		FROM job_executions
+		WHERE job_id = $1 AND ` + ownedBy(2) + `
+		ORDER BY execution_time DESC, id DESC
+		LIMIT 1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	execution, err := scanExecution(e.DB.QueryRowContext(ctx, query, jobID, userID))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return execution, nil
+}
+
+// GetAllForJob returns a page of the execution history of a job owned by the
+// user, optionally restricted to a status.
+func (e JobExecutionModel) GetAllForJob(jobID int64, userID, status string, filters Filters) ([]*JobExecution, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), `+executionColumns+`
+		FROM job_executions
+		WHERE job_id = $1 AND `+ownedBy(5)+`
+		AND (status = $2 OR $2 = '')
+		ORDER BY %s %s, id DESC
+		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := e.DB.QueryContext(ctx, query, jobID, status, filters.limit(), filters.offset(), userID)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	executions := []*JobExecution{}
+	for rows.Next() {
+		execution, err := scanExecution(rows, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		executions = append(executions, execution)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return executions, metadata, nil
+}
+
+// GetAttempts returns every attempt of the run an execution belongs to, first attempt first.
+func (e JobExecutionModel) GetAttempts(id int64) ([]*JobExecution, error) {
+	query := `
+		SELECT ` + executionColumns + `
+		FROM job_executions
+		WHERE COALESCE(retry_of, id) = (SELECT COALESCE(retry_of, id) FROM job_executions WHERE id = $1)
+		ORDER BY attempt, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := e.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	executions := []*JobExecution{}
+	for rows.Next() {
+		execution, err := scanExecution(rows)
+		if err != nil {
+			return nil, err
+		}
+		executions = append(executions, execution)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return executions, nil
+}
+
+// GetActiveForJob returns the executions of a job that are queued or running, oldest first.
+func (e JobExecutionModel) GetActiveForJob(jobID int64) ([]*JobExecution, error) {
+	query := `
+		SELECT ` + executionColumns + `
+		FROM job_executions
+		WHERE job_id = $1 AND status = ANY($2)
+		ORDER BY execution_time, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := e.DB.QueryContext(ctx, query, jobID, pq.Array(ActiveExecutionStatuses))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	executions := []*JobExecution{}
+	for rows.Next() {
+		execution, err := scanExecution(rows)
+		if err != nil {
+			return nil, err
+		}
+		executions = append(executions, execution)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return executions, nil
+}
+
+// Transition moves an execution to a new status. The update only happens if the
+// current status allows it, which is checked by the UPDATE itself so that two
+// concurrent transitions cannot both succeed. The reason is kept unchanged when empty.
+// started_at and finished_at are set when the execution starts running and reaches a final status,
+// the first heartbeat of a running execution is recorded with started_at.
+//
+// ErrRecordNotFound is returned if the execution does not exist and
+// ErrInvalidTransition if its current status does not allow the transition.
+func (e JobExecutionModel) Transition(id int64, status, reason string) error {
+	query := `
+		UPDATE job_executions
+		SET status = $2,
+			reason = COALESCE(NULLIF($3, ''), reason),
+			started_at = CASE WHEN $2 = $5 THEN NOW() ELSE started_at END,
+			heartbeat_at = CASE WHEN $2 = $5 THEN NOW() ELSE heartbeat_at END,
+			finished_at = CASE WHEN $6 THEN NOW() ELSE finished_at END,
+			last_update_time = NOW()
+		WHERE id = $1 AND status = ANY($4)`
+
+	args := []interface{}{id, status, reason, pq.Array(previousStatuses(status)),
+		ExecutionRunning, IsFinalStatus(status)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := e.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected > 0 {
+		return nil
+	}
+
+	execution, err := e.Get(id)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, execution.Status, status)
+}
+
+// CancelExecution stops an execution that is waiting to run or running. A
+// queued execution is removed from the queue and recorded as cancelled, a
+// running one is flagged cancelling for the executor running it to stop it and
+// record it as cancelled. Cancelling an execution already being cancelled does
+// nothing, ErrInvalidTransition is returned for the ones that are over.
+// execution.Status is updated to the new status.
+//
+// The queue and the status change together when m is bound to a transaction.
+func (m Models) CancelExecution(execution *JobExecution, reason string) error {
+	switch execution.Status {
+	case ExecutionQueued:
+		if err := m.Queue.DeleteExecution(execution.ID); err != nil {
+			return err
+		}
+		err := m.JobExecutions.Transition(execution.ID, ExecutionCancelled, reason)
+		if !errors.Is(err, ErrInvalidTransition) {
+			if err == nil {
+				execution.Status = ExecutionCancelled
+			}
+			return err
+		}
+		// an executor picked it up in the meantime, it is now running
+		fallthrough
+	case ExecutionRunning:
+		if err := m.JobExecutions.Transition(execution.ID, ExecutionCancelling, reason); err != nil {
+			return err
+		}
+		execution.Status = ExecutionCancelling
+		return nil
+	case ExecutionCancelling:
+		return nil
+	default:
+		return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, execution.Status, ExecutionCancelling)
+	}
+}
+
+// Heartbeat records that the executor running an execution is alive and
+// returns the current status of the execution, for the executor to stop it
+// once it is cancelling or was failed after its lease expired.
+func (e JobExecutionModel) Heartbeat(id int64) (string, error) {
+	query := `
+		UPDATE job_executions
+		SET heartbeat_at = NOW()
+		WHERE id = $1
+		RETURNING status`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var status string
+	err := e.DB.QueryRowContext(ctx, query, id).Scan(&status)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+
+	return status, nil
+}
+
+// FailExpired ends the running executions whose executor sent no heartbeat for
+// longer than the lease, as failed, or as cancelled when they were being
+// cancelled. It returns the executions it ended.
+func (e JobExecutionModel) FailExpired(lease time.Duration) ([]*JobExecution, error) {
+	query := `
+		UPDATE job_executions
+		SET status = CASE WHEN status = $2 THEN $3 ELSE $4 END,
+			reason = $5,
+			finished_at = NOW(),
+			last_update_time = NOW()
+		WHERE status IN ($2, $6)
+		AND COALESCE(heartbeat_at, last_update_time) < NOW() - $1::float8 * interval '1 second'
+		RETURNING ` + executionColumns
+
+	reason := fmt.Sprintf("executor stopped sending heartbeats for over %s", lease)
+	args := []interface{}{lease.Seconds(), ExecutionCancelling, ExecutionCancelled, ExecutionFailed, reason,
+		ExecutionRunning}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := e.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	executions := []*JobExecution{}
+	for rows.Next() {
+		execution, err := scanExecution(rows)
+		if err != nil {
+			return nil, err
+		}
+		executions = append(executions, execution)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return executions, nil
+}
+
+// SetLogsPath records where the logs of an execution are stored
+func (e JobExecutionModel) SetLogsPath(id int64, logsPath string) error {
+	query := `
+		UPDATE job_executions
+		SET logs_path = $2, last_update_time = NOW()
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := e.DB.ExecContext(ctx, query, id, logsPath)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// SetCommit records the commit checked out for an execution
+func (e JobExecutionModel) SetCommit(id int64, sha string) error {
+	query := `
+		UPDATE job_executions
+		SET commit_sha = $2, last_update_time = NOW()
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := e.DB.ExecContext(ctx, query, id, sha)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
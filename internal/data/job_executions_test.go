@@ -0,0 +1,120 @@
+package data_test
+
+import (
+	"testing"
+	"time"
+
+	. "gertanoh.job-scheduler/internal/data"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{ExecutionQueued, ExecutionRunning, true},
+		{ExecutionQueued, ExecutionCancelled, true},
+		{ExecutionQueued, ExecutionSucceeded, false},
+		{ExecutionRunning, ExecutionSucceeded, true},
+		{ExecutionRunning, ExecutionFailed, true},
+		{ExecutionRunning, ExecutionTimedOut, true},
+		{ExecutionRunning, ExecutionOOMKilled, true},
+		{ExecutionRunning, ExecutionCancelling, true},
+		{ExecutionRunning, ExecutionCancelled, false},
+		{ExecutionRunning, ExecutionQueued, false},
+		{ExecutionCancelling, ExecutionCancelled, true},
+		{ExecutionSucceeded, ExecutionFailed, false},
+		{ExecutionFailed, ExecutionRunning, false},
+		{ExecutionOOMKilled, ExecutionRunning, false},
+		{ExecutionCancelled, ExecutionRunning, false},
+		{ExecutionSkipped, ExecutionQueued, false},
+		{ExecutionSkippedMisfire, ExecutionRunning, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+"->"+tt.to, func(t *testing.T) {
+			if got := CanTransition(tt.from, tt.to); got != tt.want {
+				t.Errorf("CanTransition(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsFinalStatus(t *testing.T) {
+	for _, status := range ExecutionStatuses {
+		want := true
+		for _, active := range ActiveExecutionStatuses {
+			if status == active {
+				want = false
+			}
+		}
+
+		if got := IsFinalStatus(status); got != want {
+			t.Errorf("IsFinalStatus(%q) = %v, want %v", status, got, want)
+		}
+	}
+}
+
+func TestLeaseExpired(t *testing.T) {
+	claimed := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	lease := time.Minute
+	at := func(d time.Duration) *time.Time {
+		t := claimed.Add(d)
+		return &t
+	}
+
+	tests := []struct {
+		name      string
+		execution JobExecution
+		now       time.Time
+		want      bool
+	}{
+		{
+			name:      "Queued",
+			execution: JobExecution{Status: ExecutionQueued, LastUpdateTime: claimed},
+			now:       claimed.Add(time.Hour),
+		},
+		{
+			name:      "Executor sending heartbeats",
+			execution: JobExecution{Status: ExecutionRunning, StartedAt: at(0), HeartbeatAt: at(59 * time.Minute)},
+			now:       claimed.Add(time.Hour),
+		},
+		{
+			// the claim records the first heartbeat, the executor dies right after it
+			name:      "Executor died after the claim, within the lease",
+			execution: JobExecution{Status: ExecutionRunning, StartedAt: at(0), HeartbeatAt: at(0)},
+			now:       claimed.Add(lease),
+		},
+		{
+			name:      "Executor died after the claim",
+			execution: JobExecution{Status: ExecutionRunning, StartedAt: at(0), HeartbeatAt: at(0)},
+			now:       claimed.Add(lease + time.Second),
+			want:      true,
+		},
+		{
+			name:      "Executor died while cancelling",
+			execution: JobExecution{Status: ExecutionCancelling, StartedAt: at(0), HeartbeatAt: at(time.Minute)},
+			now:       claimed.Add(time.Hour),
+			want:      true,
+		},
+		{
+			name:      "No heartbeat recorded",
+			execution: JobExecution{Status: ExecutionRunning, LastUpdateTime: claimed},
+			now:       claimed.Add(2 * lease),
+			want:      true,
+		},
+		{
+			name:      "Finished",
+			execution: JobExecution{Status: ExecutionFailed, StartedAt: at(0), HeartbeatAt: at(0)},
+			now:       claimed.Add(time.Hour),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.execution.LeaseExpired(tt.now, lease); got != tt.want {
+				t.Errorf("LeaseExpired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// JobQueueModel is the hand-off point between the scheduler and the executors.
+// The queue lives in the job_queue table so that enqueuing can share a transaction
+// with the execution record and the schedule update.
+type JobQueueModel struct {
+	DB DBTX
+}
+
+type QueueItem struct {
+	ID          int64     `json:"id"`
+	ExecutionID int64     `json:"execution_id"`
+	JobID       int64     `json:"job_id"`
+	Priority    int       `json:"priority"`
+	EnqueuedAt  time.Time `json:"enqueued_at"`
+	// AvailableAt is when the item can be dequeued, e.g. once the backoff
+	// delay of a retry elapsed.
+	AvailableAt time.Time `json:"available_at"`
+}
+
+// Enqueue pushes an item to the queue, available right away unless AvailableAt is set.
+func (q JobQueueModel) Enqueue(item *QueueItem) error {
+	query := `
+		INSERT INTO job_queue (execution_id, job_id, priority, available_at)
+		VALUES ($1, $2, $3, COALESCE($4, NOW()))
+		RETURNING id, enqueued_at, available_at`
+
+	var availableAt *time.Time
+	if !item.AvailableAt.IsZero() {
+		availableAt = &item.AvailableAt
+	}
+	args := []interface{}{item.ExecutionID, item.JobID, item.Priority, availableAt}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return q.DB.QueryRowContext(ctx, query, args...).Scan(&item.ID, &item.EnqueuedAt, &item.AvailableAt)
+}
+
+// Dequeue removes and returns the item of the queue with the highest effective
+// priority, oldest first among equals. Items being dequeued by another executor
+// and items not available yet are skipped. ErrRecordNotFound is returned when
+// no item is available. Executors go through Models.ClaimExecution, which
+// starts the execution of the item along with its removal.
+//
+// The effective priority of an item grows by one level for every agingInterval
+// spent in the queue since it became available, so low priority jobs are not
+// starved by a steady flow of higher priority ones. Aging is disabled when agingInterval is zero.
+func (q JobQueueModel) Dequeue(agingInterval time.Duration) (*QueueItem, error) {
+	query := `
+		DELETE FROM job_queue
+		WHERE id = (
+			SELECT id FROM job_queue
+			WHERE available_at <= NOW()
+			ORDER BY priority + CASE WHEN $1::float8 > 0
+				THEN floor(extract(epoch FROM NOW() - available_at) / $1::float8)
+				ELSE 0 END DESC,
+				available_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, execution_id, job_id, priority, enqueued_at, available_at`
+
+	var item QueueItem
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := q.DB.QueryRowContext(ctx, query, agingInterval.Seconds()).Scan(
+		&item.ID,
+		&item.ExecutionID,
+		&item.JobID,
+		&item.Priority,
+		&item.EnqueuedAt,
+		&item.AvailableAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &item, nil
+}
+
+// ClaimExecution dequeues the next item, as Dequeue does, and moves its
+// execution from queued to running in the same transaction, so that an executor
+// dying in between leaves the item in the queue. Items whose execution is no
+// longer queued, e.g. cancelled while waiting, are dropped from the queue.
+// ErrRecordNotFound is returned when no item is available.
+func (m Models) ClaimExecution(ctx context.Context, agingInterval time.Duration) (*QueueItem, error) {
+	var item *QueueItem
+
+	err := m.Transaction(ctx, func(tx Models) error {
+		for {
+			var err error
+			item, err = tx.Queue.Dequeue(agingInterval)
+			if err != nil {
+				return err
+			}
+
+			err = tx.JobExecutions.Transition(item.ExecutionID, ExecutionRunning, "")
+			if errors.Is(err, ErrInvalidTransition) || errors.Is(err, ErrRecordNotFound) {
+				continue
+			}
+			return err
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// DeleteExecution removes an execution from the queue before any executor picks it up.
+func (q JobQueueModel) DeleteExecution(executionID int64) error {
+	query := `
+		DELETE FROM job_queue
+		WHERE execution_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := q.DB.ExecContext(ctx, query, executionID)
+	return err
+}
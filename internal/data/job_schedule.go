@@ -8,7 +8,7 @@ import (
 )
 
 type JobScheduleModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
 type JobSchedule struct {
@@ -18,6 +18,19 @@ type JobSchedule struct {
 	NextExecution int64     `json:"next_execution"`
 }
 
+// DueJob is a schedule row whose next execution has been reached, along with
+// the job fields needed to dispatch it and compute the following execution.
+type DueJob struct {
+	JobSchedule
+	Schedule          string
+	Timezone          string
+	RunOnce           bool
+	MisfirePolicy     string
+	MaxLateness       time.Duration
+	ConcurrencyPolicy string
+	Priority          int
+}
+
 func (j JobScheduleModel) Insert(job *JobSchedule) error {
 	query := `
 		INSERT INTO jobs_schedule (job_id, next_execution)
@@ -54,9 +67,9 @@ func (jm JobScheduleModel) Get(id int64) (*JobSchedule, error) {
 
 	err := jm.DB.QueryRowContext(ctx, query, id).Scan(
 		&job.ID,
+		&job.CreatedAt,
 		&job.JobID,
 		&job.NextExecution,
-		&job.CreatedAt,
 	)
 	// Handle any errors. If there was no matching movie found, Scan() will return
 	// a sql.ErrNoRows error. We check for this and return our custom ErrRecordNotFound
@@ -73,10 +86,46 @@ func (jm JobScheduleModel) Get(id int64) (*JobSchedule, error) {
 	return &job, nil
 }
 
+// GetByJobID returns the schedule row of a job. Jobs that will not run again,
+// such as run_once jobs that already ran, have no row and ErrRecordNotFound is returned.
+func (jm JobScheduleModel) GetByJobID(jobID int64) (*JobSchedule, error) {
+	if jobID < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, job_id, next_execution
+		FROM jobs_schedule
+		WHERE job_id = $1`
+
+	var job JobSchedule
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := jm.DB.QueryRowContext(ctx, query, jobID).Scan(
+		&job.ID,
+		&job.CreatedAt,
+		&job.JobID,
+		&job.NextExecution,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &job, nil
+}
+
 func (jm JobScheduleModel) Update(job *JobSchedule) error {
 	query := `
 		UPDATE jobs_schedule
-		SET job_id = $1, next_execution = $2, WHERE id = $3`
+		SET job_id = $1, next_execution = $2
+		WHERE id = $3`
 	args := []interface{}{job.JobID, job.NextExecution, job.ID}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -117,3 +166,56 @@ func (jm JobScheduleModel) Delete(id int64) error {
 	}
 	return nil
 }
+
+// ClaimDue locks and returns up to limit schedule rows whose next execution is at
+// or before now (unix seconds), highest job priority first then oldest first.
+// Rows already locked by another scheduler are skipped, so it must run inside a
+// transaction and the rows stay claimed until that transaction ends.
+func (jm JobScheduleModel) ClaimDue(now int64, limit int) ([]*DueJob, error) {
+	query := `
+		SELECT s.id, s.created_at, s.job_id, s.next_execution, j.schedule, j.timezone, j.run_once,
+			j.misfire_policy, j.max_lateness, j.concurrency_policy, j.priority
+		FROM jobs_schedule s
+		INNER JOIN jobs j ON j.id = s.job_id
+		WHERE s.next_execution <= $1
+		ORDER BY j.priority DESC, s.next_execution, s.id
+		LIMIT $2
+		FOR UPDATE OF s SKIP LOCKED`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := jm.DB.QueryContext(ctx, query, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	due := []*DueJob{}
+	for rows.Next() {
+		var job DueJob
+		err := rows.Scan(
+			&job.ID,
+			&job.CreatedAt,
+			&job.JobID,
+			&job.NextExecution,
+			&job.Schedule,
+			&job.Timezone,
+			&job.RunOnce,
+			&job.MisfirePolicy,
+			&job.MaxLateness,
+			&job.ConcurrencyPolicy,
+			&job.Priority,
+		)
+		if err != nil {
+			return nil, err
+		}
+		due = append(due, &job)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return due, nil
+}
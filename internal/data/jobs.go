@@ -7,15 +7,16 @@ import (
 	"time"
 
 	"gertanoh.job-scheduler/internal/ymlparser"
-	"github.com/lib/pq"
 )
 
 type JobModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
 type Job struct {
 	ID int64 `json:"id"`
+	// UserID is the OIDC subject of the owner
+	UserID string `json:"-"`
 	ymlparser.Job
 	CreatedAt time.Time `json:"created_at"`
 	Version   int32     `json:"version"`
@@ -23,11 +24,14 @@ type Job struct {
 
 func (j JobModel) Insert(job *Job) error {
 	query := `
-		INSERT INTO jobs (name, schedule, run_once, steps)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, created_at`
+		INSERT INTO jobs (user_id, job_name, schedule, timezone, run_once, misfire_policy, max_lateness,
+			concurrency_policy, priority, timeout, retry, resources, source, steps)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		RETURNING id, created_at, version`
 
-	args := []interface{}{job.Name, job.Schedule, job.RunOnce, pq.Array(job.Steps)}
+	args := []interface{}{job.UserID, job.Name, job.Schedule, job.Timezone, job.RunOnce, job.MisfirePolicy,
+		job.MaxLateness, job.ConcurrencyPolicy, job.Priority, job.Timeout, jsonb(job.Retry), jsonb(job.Resources),
+		jsonb(job.Source), jsonb(job.Steps)}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -40,28 +44,53 @@ func (j JobModel) Insert(job *Job) error {
 	return nil
 }
 
+// Get returns a job regardless of its owner, for the services acting on behalf
+// of every user. Requests made by a user go through GetForUser.
 func (jm JobModel) Get(id int64) (*Job, error) {
+	return jm.get(id, "", false)
+}
+
+// GetForUser returns a job owned by the user. ErrRecordNotFound is returned
+// for the jobs of other users.
+func (jm JobModel) GetForUser(id int64, userID string) (*Job, error) {
+	return jm.get(id, userID, true)
+}
+
+func (jm JobModel) get(id int64, userID string, scoped bool) (*Job, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
 	query := `
-		SELECT id, created_at, name, schedule, steps, run_once, version
+		SELECT id, user_id, created_at, job_name, schedule, timezone, run_once, misfire_policy, max_lateness,
+			concurrency_policy, priority, timeout, retry, resources, source, steps, version
 		FROM jobs
-		WHERE id = $1`
+		WHERE id = $1
+		AND (user_id = $2 OR NOT $3)`
 
 	var job Job
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := jm.DB.QueryRowContext(ctx, query, id).Scan(
+	err := jm.DB.QueryRowContext(ctx, query, id, userID, scoped).Scan(
 		&job.ID,
-		&job.Name,
+		&job.UserID,
 		&job.CreatedAt,
+		&job.Name,
 		&job.Schedule,
+		&job.Timezone,
 		&job.RunOnce,
-		pq.Array(&job.Steps),
+		&job.MisfirePolicy,
+		&job.MaxLateness,
+		&job.ConcurrencyPolicy,
+		&job.Priority,
+		&job.Timeout,
+		jsonb(&job.Retry),
+		jsonb(&job.Resources),
+		jsonb(&job.Source),
+		jsonb(&job.Steps),
+		&job.Version,
 	)
 	// Handle any errors. If there was no matching movie found, Scan() will return
 	// a sql.ErrNoRows error. We check for this and return our custom ErrRecordNotFound
@@ -78,35 +107,50 @@ func (jm JobModel) Get(id int64) (*Job, error) {
 	return &job, nil
 }
 
+// Update saves the job if it was not modified since it was read, as tracked by
+// its version, and still belongs to job.UserID. ErrEditConflict is returned otherwise.
 func (jm JobModel) Update(job *Job) error {
 	query := `
 		UPDATE jobs
-		SET name = $1, schedule = $2, run_once = $3, steps = $4, version = version + 1
-		WHERE id = $5 AND version = $6
+		SET job_name = $1, schedule = $2, timezone = $3, run_once = $4, misfire_policy = $5,
+			max_lateness = $6, concurrency_policy = $7, priority = $8, timeout = $9, retry = $10,
+			resources = $11, source = $12, steps = $13, version = version + 1
+		WHERE id = $14 AND version = $15 AND user_id = $16
 		RETURNING version`
-	args := []interface{}{job.Name, job.Schedule, job.RunOnce, job.Steps,
-		job.ID, job.Version}
+	args := []interface{}{job.Name, job.Schedule, job.Timezone, job.RunOnce, job.MisfirePolicy,
+		job.MaxLateness, job.ConcurrencyPolicy, job.Priority, job.Timeout, jsonb(job.Retry), jsonb(job.Resources),
+		jsonb(job.Source), jsonb(job.Steps), job.ID, job.Version, job.UserID}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := jm.DB.ExecContext(ctx, query, args...)
+	err := jm.DB.QueryRowContext(ctx, query, args...).Scan(&job.Version)
 	if err != nil {
-		return err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (jm JobModel) Delete(id int64) error {
+// Delete removes a job owned by the user, along with its schedule and execution history.
+func (jm JobModel) Delete(id int64, userID string) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
 	query := `
 		DELETE FROM jobs
-		WHERE id = $1`
+		WHERE id = $1 AND user_id = $2`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	result, err := jm.DB.ExecContext(ctx, query, id)
+	result, err := jm.DB.ExecContext(ctx, query, id, userID)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,35 @@
+package data
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// jsonbColumn maps a Go value onto a jsonb column, in the spirit of pq.Array.
+type jsonbColumn struct {
+	v interface{}
+}
+
+// jsonb wraps v so that it can be passed as a query argument or as a Scan
+// destination, in which case v must be a pointer.
+func jsonb(v interface{}) jsonbColumn {
+	return jsonbColumn{v: v}
+}
+
+func (c jsonbColumn) Value() (driver.Value, error) {
+	return json.Marshal(c.v)
+}
+
+func (c jsonbColumn) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(src, c.v)
+	case string:
+		return json.Unmarshal([]byte(src), c.v)
+	default:
+		return fmt.Errorf("cannot scan %T into a jsonb column", src)
+	}
+}
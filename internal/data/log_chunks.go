@@ -0,0 +1,91 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// LogsChannel is notified with the id of an execution when a chunk of its logs is published
+const LogsChannel = "execution_logs"
+
+type LogChunkModel struct {
+	DB DBTX
+}
+
+// LogChunk is a part of the logs of a running execution, starting at Offset
+type LogChunk struct {
+	ExecutionID int64
+	Offset      int64
+	Data        []byte
+}
+
+// End returns the offset following the chunk
+func (c *LogChunk) End() int64 {
+	return c.Offset + int64(len(c.Data))
+}
+
+// Insert publishes a chunk and notifies LogsChannel once committed
+func (m LogChunkModel) Insert(chunk *LogChunk) error {
+	query := `
+		WITH chunk AS (
+			INSERT INTO execution_log_chunks (execution_id, log_offset, data)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (execution_id, log_offset) DO UPDATE SET data = EXCLUDED.data
+			RETURNING execution_id
+		)
+		SELECT pg_notify($4, execution_id::text) FROM chunk`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, chunk.ExecutionID, chunk.Offset, chunk.Data, LogsChannel)
+	return err
+}
+
+// GetFrom returns, in order, up to limit chunks of the logs of an execution
+// ending after offset. The first one may start before offset.
+func (m LogChunkModel) GetFrom(executionID, offset int64, limit int) ([]*LogChunk, error) {
+	query := `
+		SELECT execution_id, log_offset, data
+		FROM execution_log_chunks
+		WHERE execution_id = $1 AND log_offset + length(data) > $2
+		ORDER BY log_offset
+		LIMIT $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, executionID, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chunks := []*LogChunk{}
+	for rows.Next() {
+		var chunk LogChunk
+		if err := rows.Scan(&chunk.ExecutionID, &chunk.Offset, &chunk.Data); err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, &chunk)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return chunks, nil
+}
+
+// DeleteForExecution removes the chunks of an execution whose logs are stored
+func (m LogChunkModel) DeleteForExecution(executionID int64) error {
+	query := `
+		DELETE FROM execution_log_chunks
+		WHERE execution_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, executionID)
+	return err
+}
@@ -1,6 +1,7 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 )
@@ -10,14 +11,63 @@ var (
 	ErrEditConflict   = errors.New("edit conflict")
 )
 
+// DBTX is implemented by both *sql.DB and *sql.Tx, which lets the models run
+// either directly against the pool or inside a transaction.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
 type Models struct {
-	Jobs         JobModel
-	JobsSchedule JobScheduleModel
+	db            *sql.DB
+	Jobs          JobModel
+	JobsSchedule  JobScheduleModel
+	JobExecutions JobExecutionModel
+	Steps         ExecutionStepModel
+	Artifacts     ExecutionArtifactModel
+	TestResults   ExecutionTestResultModel
+	LogChunks     LogChunkModel
+	Queue         JobQueueModel
 }
 
 func NewModels(db *sql.DB) Models {
+	models := newModels(db)
+	models.db = db
+	return models
+}
+
+func newModels(db DBTX) Models {
 	return Models{
-		Jobs:         JobModel{DB: db},
-		JobsSchedule: JobScheduleModel{DB: db},
+		Jobs:          JobModel{DB: db},
+		JobsSchedule:  JobScheduleModel{DB: db},
+		JobExecutions: JobExecutionModel{DB: db},
+		Steps:         ExecutionStepModel{DB: db},
+		Artifacts:     ExecutionArtifactModel{DB: db},
+		TestResults:   ExecutionTestResultModel{DB: db},
+		LogChunks:     LogChunkModel{DB: db},
+		Queue:         JobQueueModel{DB: db},
+	}
+}
+
+// Transaction runs fn with models bound to a single transaction. The transaction
+// is committed if fn returns nil and rolled back otherwise.
+// The models handed to fn cannot start a nested transaction.
+func (m Models) Transaction(ctx context.Context, fn func(tx Models) error) error {
+	if m.db == nil {
+		return errors.New("nested transactions are not supported")
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
 	}
+
+	if err := fn(newModels(tx)); err != nil {
+		// the error from fn is more useful than a failed rollback
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
 }
@@ -1,105 +1,279 @@
 package executor
 
 import (
+	"archive/tar"
 	"context"
+	"errors"
 	"fmt"
-	"os"
+	"io"
+	"path"
+	"strings"
 	"time"
 
-	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
 	"github.com/docker/docker/pkg/stdcopy"
+	"go.uber.org/zap"
 )
 
-// DockerExecutor implements the executor interface for Docker
+// containerWorkspace is where Command.WorkDir is mounted in the container
+const containerWorkspace = "/workspace"
+
+// dockerAPITimeout bounds the Docker API calls made outside of the run context
+const dockerAPITimeout = 30 * time.Second
+
+// DockerExecutor implements the executor interface for Docker. Command.WorkDir
+// is bind-mounted into the containers, so the daemon must run on this host: a
+// remote daemon would mount a directory of its own host. CopyFrom reads the
+// directory through a container as well, so that it returns what the steps
+// saw, e.g. with the ownership set by the daemon.
 type DockerExecutor struct {
 	cli *client.Client
+	// logger records the failures of the calls made in the background, which
+	// cannot be returned
+	logger *zap.Logger
 }
 
+var _ Executor = (*DockerExecutor)(nil)
+
 // NewDockerExecutor instance creator
-func NewDockerExecutor() (*DockerExecutor, error) {
+func NewDockerExecutor(logger *zap.Logger) (*DockerExecutor, error) {
 	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 	if err != nil {
 		return nil, err
 	}
-	return &DockerExecutor{cli: cli}, nil
+	return &DockerExecutor{cli: cli, logger: logger}, nil
+}
+
+// Ping checks that the Docker daemon answers
+func (de *DockerExecutor) Ping(ctx context.Context) error {
+	_, err := de.cli.Ping(ctx)
+	return err
 }
 
-// RunCommand executes a command inside a Docker container and returns the logs
-func (de *DockerExecutor) RunCommand(ctx context.Context image string, cmd []string) error {
+// Start runs the command in a new container of cmd.Image, with cmd.Resources
+// as its limits. The container is removed once the command exited.
+func (de *DockerExecutor) Start(ctx context.Context, cmd Command) (Handle, error) {
 
-	// Create container
-	resp, err := de.cli.ContainerCreate(ctx, &container.Config{
-		Image: image,
-		Cmd:   cmd,
+	config := &container.Config{
+		Image: cmd.Image,
+		Cmd:   cmd.Cmd,
+		Env:   envList(cmd.Env),
 		Tty:   false,
-	}, nil, nil, nil, "")
+	}
+	hostConfig := &container.HostConfig{Resources: dockerResources(cmd.Resources)}
+	if cmd.Resources.TmpfsSize > 0 {
+		hostConfig.Tmpfs = map[string]string{"/tmp": fmt.Sprintf("rw,nosuid,nodev,size=%d", cmd.Resources.TmpfsSize)}
+	}
+	if cmd.WorkDir != "" {
+		config.WorkingDir = containerWorkspace
+		hostConfig.Binds = []string{cmd.WorkDir + ":" + containerWorkspace}
+	}
+
+	// Create container
+	resp, err := de.cli.ContainerCreate(ctx, config, hostConfig, nil, nil, "")
 	if err != nil {
-		return fmt.Errorf("failed to create container: %v", err)
+		return nil, fmt.Errorf("failed to create container: %v", err)
 	}
 
 	// Start container
 	if err := de.cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
-		return fmt.Errorf("failed to start container: %v", err)
+		de.remove(resp.ID)
+		return nil, fmt.Errorf("failed to start container: %v", err)
 	}
 
-	// Periodically check container status
-	go de.monitorContainerStatus(ctx, resp.ID)
+	h := newHandle(
+		func() error { return de.stop(resp.ID, cmd.StopGrace) },
+		func() error { return de.kill(resp.ID) },
+		cmd.StopGrace,
+	)
+	go de.follow(ctx, h, resp.ID, cmd.Timeout)
 
-	// Wait for container to finish
-	statusCh, errCh := de.cli.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
-	select {
-	case err := <-errCh:
+	return h, nil
+}
+
+// CopyFrom archives cmd.WorkDir as mounted in a container of cmd.Image, which
+// is created but never started. The container is removed once the archive was
+// read or closed.
+func (de *DockerExecutor) CopyFrom(ctx context.Context, cmd Command) (io.ReadCloser, error) {
+	if cmd.WorkDir == "" {
+		return nil, errors.New("no working directory to copy from")
+	}
+
+	// the command is never run, it only spares images without one a creation error
+	config := &container.Config{Image: cmd.Image, Cmd: []string{"true"}}
+	hostConfig := &container.HostConfig{Binds: []string{cmd.WorkDir + ":" + containerWorkspace}}
+	resp, err := de.cli.ContainerCreate(ctx, config, hostConfig, nil, nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create container: %v", err)
+	}
+
+	content, _, err := de.cli.CopyFromContainer(ctx, resp.ID, containerWorkspace)
+	if err != nil {
+		de.remove(resp.ID)
+		return nil, fmt.Errorf("failed to copy from container: %v", err)
+	}
+
+	r, w := io.Pipe()
+	go func() {
+		err := trimArchive(w, content, path.Base(containerWorkspace))
+		content.Close()
+		de.remove(resp.ID)
+		w.CloseWithError(err)
+	}()
+	return r, nil
+}
+
+// trimArchive copies a tar archive of the root directory without the root
+// itself, its entries renamed after their path in root
+func trimArchive(w io.Writer, archive io.Reader, root string) error {
+	tr := tar.NewReader(archive)
+	tw := tar.NewWriter(w)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return tw.Close()
+		}
 		if err != nil {
-			return fmt.Errorf("error while waiting for container: %v", err)
+			return err
+		}
+
+		name, ok := strings.CutPrefix(header.Name, root+"/")
+		if !ok || name == "" {
+			continue
+		}
+		header.Name = name
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
 		}
-	case <-statusCh:
 	}
+}
+
+// follow streams the container output to the handle until the container exits,
+// records its exit code and removes it. The container is killed if the run
+// context is cancelled or the timeout elapsed.
+func (de *DockerExecutor) follow(ctx context.Context, h *handle, containerID string, timeout time.Duration) {
+	defer h.watch(ctx, timeout)()
 
-	// Retrieve container logs
-	out, err := de.cli.ContainerLogs(ctx, resp.ID, container.LogsOptions{ShowStdout: true})
+	// the log stream ends when the container stops
+	out, err := de.cli.ContainerLogs(context.Background(), containerID, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to retrieve container logs: %v", err)
+		de.kill(containerID)
+		de.remove(containerID)
+		h.finish(-1, fmt.Errorf("failed to retrieve container logs: %v", err))
+		return
+	}
+	_, logsErr := stdcopy.StdCopy(h.stdoutW, h.stderrW, out)
+	out.Close()
+
+	// Wait for container to finish
+	exitCode, err := de.wait(containerID)
+	if err == nil {
+		var oomKilled bool
+		oomKilled, err = de.oomKilled(containerID)
+		h.oomKilled.Store(oomKilled)
+	}
+	de.remove(containerID)
+
+	switch {
+	case err != nil:
+		h.finish(-1, err)
+	case logsErr != nil:
+		h.finish(int(exitCode), fmt.Errorf("failed to read container logs: %v", logsErr))
+	default:
+		h.finish(int(exitCode), nil)
+	}
+}
+
+// wait blocks until the container is stopped and returns its exit code
+func (de *DockerExecutor) wait(containerID string) (int64, error) {
+	statusCh, errCh := de.cli.ContainerWait(context.Background(), containerID, container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		return -1, fmt.Errorf("error while waiting for container: %v", err)
+	case status := <-statusCh:
+		if status.Error != nil {
+			return -1, fmt.Errorf("error while waiting for container: %s", status.Error.Message)
+		}
+		return status.StatusCode, nil
 	}
+}
 
-	stdcopy.StdCopy(os.Stdout, os.Stderr, out)
+// oomKilled reports whether the stopped container was killed for exceeding its memory limit
+func (de *DockerExecutor) oomKilled(containerID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dockerAPITimeout)
+	defer cancel()
 
-	// Remove container
-	err = de.cli.ContainerRemove(ctx, resp.ID, container.RemoveOptions{})
+	info, err := de.cli.ContainerInspect(ctx, containerID)
 	if err != nil {
-		return fmt.Errorf("failed to remove container: %v", err)
+		return false, fmt.Errorf("failed to inspect container: %v", err)
 	}
+	return info.State != nil && info.State.OOMKilled, nil
+}
+
+// stop asks the container to stop, Docker kills it once the grace period
+// elapsed. The call does not wait for the container to exit.
+func (de *DockerExecutor) stop(containerID string, grace time.Duration) error {
+	seconds := int(grace.Round(time.Second) / time.Second)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), grace+dockerAPITimeout)
+		defer cancel()
 
+		err := de.cli.ContainerStop(ctx, containerID, container.StopOptions{Timeout: &seconds})
+		if err != nil && !isNotRunning(err) {
+			de.logger.Error("Failed to stop container", zap.String("container_id", containerID), zap.Error(err))
+		}
+	}()
 	return nil
 }
 
-// monitorContainerStatus periodically checks the status of the container
-func (de *DockerExecutor) monitorContainerStatus(ctx context.Context, containerID string) {
-	ticker := time.NewTicker(10 * time.Second) // Adjust the interval as needed
+// kill stops the container right away
+func (de *DockerExecutor) kill(containerID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dockerAPITimeout)
+	defer cancel()
 
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			containerInfo, err := de.cli.ContainerInspect(ctx, containerID)
-			if err != nil {
-				fmt.Printf("Error checking container status: %v\n", err)
-				return
-			}
-
-			if containerInfo.State.Status == "running" {
-				fmt.Printf("Container %s finished with status: %s\n", containerID, containerInfo.State.Status)
-				continue
-			}
-
-			fmt.Printf("Container %s finished with status: %s\n", containerID, containerInfo.State.Status)
-
-			if containerInfo.State.Dead{
-				continue
-			}
-			return
-		}
+	if err := de.cli.ContainerKill(ctx, containerID, "SIGKILL"); err != nil && !isNotRunning(err) {
+		return fmt.Errorf("failed to kill container: %v", err)
+	}
+	return nil
+}
+
+// remove removes a container, killing it if it still runs
+func (de *DockerExecutor) remove(containerID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), dockerAPITimeout)
+	defer cancel()
+
+	if err := de.cli.ContainerRemove(ctx, containerID, container.RemoveOptions{Force: true}); err != nil {
+		de.logger.Error("Failed to remove container", zap.String("container_id", containerID), zap.Error(err))
 	}
 }
+
+// dockerResources maps the limits of a command onto the container resources.
+// Swap is disabled for containers with a memory limit, so that the limit holds.
+func dockerResources(r Resources) container.Resources {
+	resources := container.Resources{
+		NanoCPUs: int64(r.CPUs * 1e9),
+		Memory:   r.Memory,
+	}
+	if r.Memory > 0 {
+		resources.MemorySwap = r.Memory
+	}
+	if r.PIDs > 0 {
+		resources.PidsLimit = &r.PIDs
+	}
+	return resources
+}
+
+// isNotRunning reports whether a Docker API error is due to the container
+// being already stopped or removed
+func isNotRunning(err error) bool {
+	return client.IsErrNotFound(err) || errdefs.IsConflict(err)
+}
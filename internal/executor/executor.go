@@ -1,8 +1,330 @@
+// Package executor runs the commands of job steps in isolated environments.
 package executor
 
-import "io"
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
-// Executor interface
+// Command describes a command to run
+type Command struct {
+	// Image the command runs in, for the executors running containers
+	Image string
+	Cmd   []string
+	Env   map[string]string
+	// WorkDir is a host directory the command runs in, mounted at /workspace by
+	// the isolated executors. When empty the command gets a throwaway one.
+	WorkDir string
+	// Timeout stops the command once elapsed, no limit when zero
+	Timeout time.Duration
+	// StopGrace is how long a stopped command is given to exit after being
+	// asked to terminate, before it is killed. It is killed right away when zero.
+	StopGrace time.Duration
+	Resources Resources
+}
+
+// Resources limits what a command can use, zero values are unlimited. Which
+// limits are enforced depends on the executor.
+type Resources struct {
+	// CPUs is the number of CPUs the command can use, e.g. 1.5
+	CPUs float64
+	// Memory is the memory limit in bytes, the command is killed when it exceeds it
+	Memory int64
+	// PIDs is the maximum number of processes and threads
+	PIDs int64
+	// TmpfsSize is the size in bytes of the tmpfs mounted on /tmp
+	TmpfsSize int64
+}
+
+// Executor starts commands. The command is stopped when the context is
+// cancelled or its timeout elapsed.
 type Executor interface {
-	RunCommand(image string, cmd []string) (io.ReadCloser, error)
+	Start(ctx context.Context, cmd Command) (Handle, error)
+	// CopyFrom returns the content of cmd.WorkDir as the commands run in cmd
+	// see it, as a tar archive whose entries are named after their slash
+	// separated path in the directory. The archive must be closed.
+	CopyFrom(ctx context.Context, cmd Command) (io.ReadCloser, error)
+}
+
+// Handle is a started command.
+//
+// Stdout and Stderr must both be read until EOF, which they reach once the command
+// exited: an executor may block the command while its output is not consumed.
+type Handle interface {
+	Stdout() io.Reader
+	Stderr() io.Reader
+	// Wait blocks until the command exited and its output was written. The error
+	// reports a failure of the executor, a non-zero exit is only reported by ExitCode.
+	Wait() error
+	// ExitCode returns the exit status of the command, -1 while it runs. A
+	// command that was cancelled reports a non-zero status.
+	ExitCode() int
+	StartedAt() time.Time
+	FinishedAt() time.Time
+	// TimedOut reports whether the command was stopped by its timeout
+	TimedOut() bool
+	// OOMKilled reports whether the command was killed for exceeding its memory limit
+	OOMKilled() bool
+	// Cancel stops the command: it is asked to terminate, then killed once the
+	// stop grace period elapsed. Wait returns once it is gone.
+	Cancel() error
+}
+
+// Result is the outcome of a command run by Run
+type Result struct {
+	ExitCode   int
+	TimedOut   bool
+	OOMKilled  bool
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// Run starts the command, copies its output to stdout and stderr until it
+// exits and returns its result.
+func Run(ctx context.Context, e Executor, cmd Command, stdout, stderr io.Writer) (*Result, error) {
+	h, err := e.Start(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var wg sync.WaitGroup
+	copyOutput := func(dst io.Writer, src io.Reader) {
+		defer wg.Done()
+		// keep draining the stream when dst fails so that the command is not blocked
+		if _, err := io.Copy(dst, src); err != nil {
+			io.Copy(io.Discard, src)
+		}
+	}
+	wg.Add(2)
+	go copyOutput(stdout, h.Stdout())
+	go copyOutput(stderr, h.Stderr())
+	wg.Wait()
+
+	if err := h.Wait(); err != nil {
+		return nil, err
+	}
+
+	return &Result{
+		ExitCode:   h.ExitCode(),
+		TimedOut:   h.TimedOut(),
+		OOMKilled:  h.OOMKilled(),
+		StartedAt:  h.StartedAt(),
+		FinishedAt: h.FinishedAt(),
+	}, nil
+}
+
+// envList returns the environment as a sorted list of NAME=value entries
+func envList(env map[string]string) []string {
+	list := make([]string, 0, len(env))
+	for name, value := range env {
+		list = append(list, name+"="+value)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// archiveDir streams the content of a host directory as a tar archive, for the
+// executors running the commands on the host filesystem. Files other than
+// directories, regular files and symbolic links are left out.
+func archiveDir(dir string) (io.ReadCloser, error) {
+	if dir == "" {
+		return nil, errors.New("no working directory to copy from")
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(writeArchive(w, dir))
+	}()
+	return r, nil
+}
+
+func writeArchive(w io.Writer, dir string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || name == dir {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		var link string
+		switch mode := info.Mode(); {
+		case mode.Type() == fs.ModeSymlink:
+			if link, err = os.Readlink(name); err != nil {
+				return err
+			}
+		case !mode.IsDir() && !mode.IsRegular():
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// handle implements Handle for the executors. The executor writes the output
+// to the pipes and calls finish once the command exited. terminate asks the
+// command to exit, kill stops it right away.
+type handle struct {
+	stdout, stderr *io.PipeReader
+	stdoutW        *io.PipeWriter
+	stderrW        *io.PipeWriter
+	startedAt      time.Time
+	terminate      func() error
+	kill           func() error
+	grace          time.Duration
+
+	cancelOnce sync.Once
+	timedOut   atomic.Bool
+	oomKilled  atomic.Bool
+
+	done       chan struct{}
+	exitCode   int
+	finishedAt time.Time
+	err        error
+}
+
+func newHandle(terminate, kill func() error, grace time.Duration) *handle {
+	h := &handle{
+		startedAt: time.Now(),
+		terminate: terminate,
+		kill:      kill,
+		grace:     grace,
+		done:      make(chan struct{}),
+		exitCode:  -1,
+	}
+	h.stdout, h.stdoutW = io.Pipe()
+	h.stderr, h.stderrW = io.Pipe()
+	return h
+}
+
+// watch stops the command when the context is cancelled or the timeout
+// elapsed. The returned function releases the watch.
+func (h *handle) watch(ctx context.Context, timeout time.Duration) func() {
+	stop := context.AfterFunc(ctx, func() { h.Cancel() })
+	if timeout <= 0 {
+		return func() { stop() }
+	}
+
+	timer := time.AfterFunc(timeout, func() {
+		h.timedOut.Store(true)
+		h.Cancel()
+	})
+	return func() {
+		stop()
+		timer.Stop()
+	}
+}
+
+// finish records the outcome of the command, closes its output and releases Wait
+func (h *handle) finish(exitCode int, err error) {
+	h.exitCode = exitCode
+	h.err = err
+	h.finishedAt = time.Now()
+	h.stdoutW.Close()
+	h.stderrW.Close()
+	close(h.done)
+}
+
+func (h *handle) Stdout() io.Reader { return h.stdout }
+
+func (h *handle) Stderr() io.Reader { return h.stderr }
+
+func (h *handle) Wait() error {
+	<-h.done
+	return h.err
+}
+
+func (h *handle) ExitCode() int {
+	select {
+	case <-h.done:
+		return h.exitCode
+	default:
+		return -1
+	}
+}
+
+func (h *handle) StartedAt() time.Time { return h.startedAt }
+
+func (h *handle) FinishedAt() time.Time {
+	select {
+	case <-h.done:
+		return h.finishedAt
+	default:
+		return time.Time{}
+	}
+}
+
+func (h *handle) TimedOut() bool { return h.timedOut.Load() }
+
+func (h *handle) OOMKilled() bool { return h.oomKilled.Load() }
+
+func (h *handle) Cancel() error {
+	select {
+	case <-h.done:
+		return nil
+	default:
+	}
+
+	var err error
+	h.cancelOnce.Do(func() {
+		if h.grace <= 0 {
+			err = h.kill()
+			return
+		}
+		if err = h.terminate(); err != nil {
+			err = h.kill()
+			return
+		}
+		go func() {
+			select {
+			case <-h.done:
+			case <-time.After(h.grace):
+				h.kill()
+			}
+		}()
+	})
+	return err
 }
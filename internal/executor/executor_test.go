@@ -0,0 +1,299 @@
+package executor_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "gertanoh.job-scheduler/internal/executor"
+	"go.uber.org/zap/zaptest"
+)
+
+// testExecutor checks that an executor honours the step contract: output
+// streaming, exit codes, environment, timestamps and cancellation. Every
+// Executor implementation runs it.
+func testExecutor(t *testing.T, e Executor, image string) {
+	shell := func(script string) Command {
+		return Command{Image: image, Cmd: []string{"sh", "-c", script}}
+	}
+
+	tests := []struct {
+		name         string
+		cmd          Command
+		wantStdout   string
+		wantStderr   string
+		wantExitCode int
+	}{
+		{
+			name:       "Output streams",
+			cmd:        shell("echo out; echo err >&2"),
+			wantStdout: "out\n",
+			wantStderr: "err\n",
+		},
+		{
+			name:         "Exit code",
+			cmd:          shell("echo failing; exit 3"),
+			wantStdout:   "failing\n",
+			wantExitCode: 3,
+		},
+		{
+			name: "Environment",
+			cmd: Command{
+				Image: image,
+				Cmd:   []string{"sh", "-c", `echo "$GREETING $NAME"`},
+				Env:   map[string]string{"GREETING": "hello", "NAME": "world"},
+			},
+			wantStdout: "hello world\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			var stdout, stderr bytes.Buffer
+			result, err := Run(ctx, e, tt.cmd, &stdout, &stderr)
+			if err != nil {
+				t.Fatalf("Run() unexpected error: %v", err)
+			}
+
+			if result.ExitCode != tt.wantExitCode {
+				t.Errorf("Run() exit code = %d, want %d", result.ExitCode, tt.wantExitCode)
+			}
+			if stdout.String() != tt.wantStdout {
+				t.Errorf("Run() stdout = %q, want %q", stdout.String(), tt.wantStdout)
+			}
+			if stderr.String() != tt.wantStderr {
+				t.Errorf("Run() stderr = %q, want %q", stderr.String(), tt.wantStderr)
+			}
+			if result.StartedAt.IsZero() || result.FinishedAt.Before(result.StartedAt) {
+				t.Errorf("Run() started at %v, finished at %v", result.StartedAt, result.FinishedAt)
+			}
+		})
+	}
+
+	t.Run("Shared working directory", func(t *testing.T) {
+		workDir := t.TempDir()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		for i, script := range []string{"echo built > artifact", "cat artifact"} {
+			cmd := shell(script)
+			cmd.WorkDir = workDir
+
+			var stdout, stderr bytes.Buffer
+			result, err := Run(ctx, e, cmd, &stdout, &stderr)
+			if err != nil {
+				t.Fatalf("Run() unexpected error: %v", err)
+			}
+			if result.ExitCode != 0 {
+				t.Fatalf("Run() step %d exit code = %d, stderr %q", i, result.ExitCode, stderr.String())
+			}
+			if i == 1 && stdout.String() != "built\n" {
+				t.Errorf("Run() stdout = %q, want %q", stdout.String(), "built\n")
+			}
+		}
+
+		if _, err := os.Stat(filepath.Join(workDir, "artifact")); err != nil {
+			t.Errorf("working directory not kept: %v", err)
+		}
+	})
+
+	t.Run("Copy from working directory", func(t *testing.T) {
+		workDir := t.TempDir()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		cmd := shell("mkdir -p bin/tools && echo app > bin/app && echo tool > bin/tools/tool && ln -s app bin/link")
+		cmd.WorkDir = workDir
+		var stderr bytes.Buffer
+		result, err := Run(ctx, e, cmd, io.Discard, &stderr)
+		if err != nil {
+			t.Fatalf("Run() unexpected error: %v", err)
+		}
+		if result.ExitCode != 0 {
+			t.Fatalf("Run() exit code = %d, stderr %q", result.ExitCode, stderr.String())
+		}
+
+		archive, err := e.CopyFrom(ctx, Command{Image: image, WorkDir: workDir})
+		if err != nil {
+			t.Fatalf("CopyFrom() unexpected error: %v", err)
+		}
+		defer archive.Close()
+
+		want := map[string]string{
+			"bin/":           "",
+			"bin/app":        "app\n",
+			"bin/link":       "-> app",
+			"bin/tools/":     "",
+			"bin/tools/tool": "tool\n",
+		}
+		got := map[string]string{}
+		tr := tar.NewReader(archive)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("CopyFrom() invalid archive: %v", err)
+			}
+			switch header.Typeflag {
+			case tar.TypeReg:
+				content, _ := io.ReadAll(tr)
+				got[header.Name] = string(content)
+			case tar.TypeSymlink:
+				got[header.Name] = "-> " + header.Linkname
+			default:
+				got[header.Name] = ""
+			}
+		}
+
+		if len(got) != len(want) {
+			t.Errorf("CopyFrom() entries = %v, want %v", got, want)
+		}
+		for name, content := range want {
+			if got[name] != content {
+				t.Errorf("CopyFrom() entry %s = %q, want %q", name, got[name], content)
+			}
+		}
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		h, err := e.Start(context.Background(), shell("echo started; sleep 60"))
+		if err != nil {
+			t.Fatalf("Start() unexpected error: %v", err)
+		}
+		go io.Copy(io.Discard, h.Stderr())
+
+		// wait for the command to run before cancelling it
+		buf := make([]byte, len("started\n"))
+		if _, err := io.ReadFull(h.Stdout(), buf); err != nil {
+			t.Fatalf("reading stdout: %v", err)
+		}
+		if err := h.Cancel(); err != nil {
+			t.Fatalf("Cancel() unexpected error: %v", err)
+		}
+		go io.Copy(io.Discard, h.Stdout())
+
+		assertStopped(t, h)
+		if h.TimedOut() {
+			t.Errorf("TimedOut() = true for a cancelled command")
+		}
+	})
+
+	t.Run("Graceful stop", func(t *testing.T) {
+		cmd := shell(`trap 'echo terminated; exit 143' TERM; echo started; while :; do sleep 0.1; done`)
+		cmd.StopGrace = 20 * time.Second
+
+		h, err := e.Start(context.Background(), cmd)
+		if err != nil {
+			t.Fatalf("Start() unexpected error: %v", err)
+		}
+		go io.Copy(io.Discard, h.Stderr())
+
+		buf := make([]byte, len("started\n"))
+		if _, err := io.ReadFull(h.Stdout(), buf); err != nil {
+			t.Fatalf("reading stdout: %v", err)
+		}
+		if err := h.Cancel(); err != nil {
+			t.Fatalf("Cancel() unexpected error: %v", err)
+		}
+		rest, err := io.ReadAll(h.Stdout())
+		if err != nil {
+			t.Fatalf("reading stdout: %v", err)
+		}
+
+		assertStopped(t, h)
+		if string(rest) != "terminated\n" {
+			t.Errorf("stdout after Cancel() = %q, want %q", rest, "terminated\n")
+		}
+		if h.ExitCode() != 143 {
+			t.Errorf("ExitCode() = %d, want 143", h.ExitCode())
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		cmd := shell("sleep 60")
+		cmd.Timeout = 500 * time.Millisecond
+
+		h, err := e.Start(context.Background(), cmd)
+		if err != nil {
+			t.Fatalf("Start() unexpected error: %v", err)
+		}
+		go io.Copy(io.Discard, h.Stdout())
+		go io.Copy(io.Discard, h.Stderr())
+
+		assertStopped(t, h)
+		if !h.TimedOut() {
+			t.Errorf("TimedOut() = false for a command stopped by its timeout")
+		}
+	})
+
+	t.Run("Context cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		h, err := e.Start(ctx, shell("sleep 60"))
+		if err != nil {
+			t.Fatalf("Start() unexpected error: %v", err)
+		}
+		go io.Copy(io.Discard, h.Stdout())
+		go io.Copy(io.Discard, h.Stderr())
+
+		cancel()
+		assertStopped(t, h)
+	})
+}
+
+// assertStopped checks that a cancelled command exits promptly with a failure
+func assertStopped(t *testing.T, h Handle) {
+	t.Helper()
+
+	done := make(chan error, 1)
+	go func() { done <- h.Wait() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Wait() unexpected error: %v", err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("Wait() did not return after the command was cancelled")
+	}
+
+	if h.ExitCode() == 0 {
+		t.Errorf("ExitCode() = 0 for a cancelled command")
+	}
+}
+
+func TestDockerExecutor(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping Docker tests in short mode")
+	}
+
+	de, err := NewDockerExecutor(zaptest.NewLogger(t))
+	if err != nil {
+		t.Skipf("Docker client unavailable: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := de.Ping(ctx); err != nil {
+		t.Skipf("Docker daemon unavailable: %v", err)
+	}
+
+	// the image must be present on the host, it is not pulled
+	image := os.Getenv("EXECUTOR_TEST_IMAGE")
+	if image == "" {
+		image = "alpine:latest"
+	}
+
+	testExecutor(t, de, image)
+}
@@ -0,0 +1,123 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+)
+
+// defaultPath is the PATH of the commands when the host has none
+const defaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// ProcessExecutor runs commands as local processes, without isolation. It is
+// meant for development and tests on hosts without a Docker daemon.
+//
+// Each command runs in Command.WorkDir or a throwaway working directory, in its own process group
+// so that the processes it spawns are killed with it, and with a scrubbed
+// environment: only PATH is kept from the host, HOME and TMPDIR point to the
+// working directory. Command.Image and Command.Resources are ignored. It
+// requires a Unix host.
+type ProcessExecutor struct {
+	baseDir string
+}
+
+var _ Executor = (*ProcessExecutor)(nil)
+
+// NewProcessExecutor instance creator. The working directories are created in
+// baseDir, the system temporary directory when empty.
+func NewProcessExecutor(baseDir string) *ProcessExecutor {
+	return &ProcessExecutor{baseDir: baseDir}
+}
+
+// CopyFrom archives cmd.WorkDir, which the commands use in place
+func (pe *ProcessExecutor) CopyFrom(ctx context.Context, cmd Command) (io.ReadCloser, error) {
+	return archiveDir(cmd.WorkDir)
+}
+
+// startProcess starts c with its output streamed to a new handle, stopped
+// according to the timeout and stop grace of cmd. signal delivers a signal to
+// the process and its children, cleanup is called with its pid once it exited
+// and before the handle is finished.
+func startProcess(ctx context.Context, c *exec.Cmd, cmd Command, signal func(pid int, sig syscall.Signal) error, cleanup func(pid int)) (*handle, error) {
+	// the process writes to plain pipes rather than to the handle, so that Wait
+	// does not depend on the processes it left behind closing their output
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stderrR, stderrW, err := os.Pipe()
+	if err != nil {
+		stdoutR.Close()
+		stdoutW.Close()
+		return nil, err
+	}
+	c.Stdout = stdoutW
+	c.Stderr = stderrW
+
+	err = c.Start()
+	stdoutW.Close()
+	stderrW.Close()
+	if err != nil {
+		stdoutR.Close()
+		stderrR.Close()
+		return nil, fmt.Errorf("failed to start process: %v", err)
+	}
+
+	pid := c.Process.Pid
+	h := newHandle(
+		func() error { return signal(pid, syscall.SIGTERM) },
+		func() error { return signal(pid, syscall.SIGKILL) },
+		cmd.StopGrace,
+	)
+
+	go func() {
+		defer h.watch(ctx, cmd.Timeout)()
+
+		var wg sync.WaitGroup
+		copyOutput := func(dst io.Writer, src *os.File) {
+			defer wg.Done()
+			io.Copy(dst, src)
+			src.Close()
+		}
+		wg.Add(2)
+		go copyOutput(h.stdoutW, stdoutR)
+		go copyOutput(h.stderrW, stderrR)
+
+		err := c.Wait()
+		cleanup(pid)
+		wg.Wait()
+
+		var exitErr *exec.ExitError
+		if err != nil && !errors.As(err, &exitErr) {
+			h.finish(-1, fmt.Errorf("failed to wait for process: %v", err))
+			return
+		}
+		h.finish(c.ProcessState.ExitCode(), nil)
+	}()
+
+	return h, nil
+}
+
+// processEnv returns the environment of a process run in workDir: the host's
+// PATH, HOME and TMPDIR set to workDir, then the command's variables.
+func processEnv(workDir string, env map[string]string) []string {
+	path := os.Getenv("PATH")
+	if path == "" {
+		path = defaultPath
+	}
+
+	base := map[string]string{
+		"PATH":   path,
+		"HOME":   workDir,
+		"TMPDIR": workDir,
+	}
+	for name, value := range env {
+		base[name] = value
+	}
+	return envList(base)
+}
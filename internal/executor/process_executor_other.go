@@ -0,0 +1,13 @@
+//go:build !unix
+
+package executor
+
+import (
+	"context"
+	"errors"
+)
+
+// Start fails on hosts without process groups
+func (pe *ProcessExecutor) Start(ctx context.Context, cmd Command) (Handle, error) {
+	return nil, errors.New("the process executor requires a Unix host")
+}
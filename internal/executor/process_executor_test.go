@@ -0,0 +1,71 @@
+package executor_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	. "gertanoh.job-scheduler/internal/executor"
+)
+
+func TestProcessExecutor(t *testing.T) {
+	testExecutor(t, NewProcessExecutor(t.TempDir()), "")
+}
+
+func TestProcessExecutorIsolation(t *testing.T) {
+	baseDir := t.TempDir()
+	pe := NewProcessExecutor(baseDir)
+
+	t.Setenv("EXECUTOR_TEST_SECRET", "secret")
+
+	tests := []struct {
+		name       string
+		script     string
+		wantStdout string
+	}{
+		{
+			name:       "Environment scrubbed",
+			script:     `echo "${EXECUTOR_TEST_SECRET:-unset}"`,
+			wantStdout: "unset\n",
+		},
+		{
+			name:       "Empty working directory",
+			script:     `touch created; ls -A; [ "$PWD" = "$HOME" ] && echo home`,
+			wantStdout: "created\nhome\n",
+		},
+		{
+			name:       "Working directory not reused",
+			script:     `ls -A`,
+			wantStdout: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			var stdout, stderr bytes.Buffer
+			result, err := Run(ctx, pe, Command{Cmd: []string{"sh", "-c", tt.script}}, &stdout, &stderr)
+			if err != nil {
+				t.Fatalf("Run() unexpected error: %v", err)
+			}
+			if result.ExitCode != 0 {
+				t.Fatalf("Run() exit code = %d, stderr %q", result.ExitCode, stderr.String())
+			}
+			if stdout.String() != tt.wantStdout {
+				t.Errorf("Run() stdout = %q, want %q", stdout.String(), tt.wantStdout)
+			}
+		})
+	}
+
+	entries, err := os.ReadDir(baseDir)
+	if err != nil {
+		t.Fatalf("ReadDir() unexpected error: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("%d working directories left behind", len(entries))
+	}
+}
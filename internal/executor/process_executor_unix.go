@@ -0,0 +1,57 @@
+//go:build unix
+
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// Start runs the command in a new process group
+func (pe *ProcessExecutor) Start(ctx context.Context, cmd Command) (Handle, error) {
+	if len(cmd.Cmd) == 0 {
+		return nil, errors.New("empty command")
+	}
+
+	workDir, throwaway := cmd.WorkDir, cmd.WorkDir == ""
+	if throwaway {
+		dir, err := os.MkdirTemp(pe.baseDir, "step-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create working directory: %v", err)
+		}
+		workDir = dir
+	}
+	removeWorkDir := func() {
+		if throwaway {
+			os.RemoveAll(workDir)
+		}
+	}
+
+	c := exec.Command(cmd.Cmd[0], cmd.Cmd[1:]...)
+	c.Dir = workDir
+	c.Env = processEnv(workDir, cmd.Env)
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	h, err := startProcess(ctx, c, cmd, signalGroup, func(pid int) {
+		// background processes would otherwise keep the output open
+		signalGroup(pid, syscall.SIGKILL)
+		removeWorkDir()
+	})
+	if err != nil {
+		removeWorkDir()
+		return nil, err
+	}
+	return h, nil
+}
+
+// signalGroup sends a signal to every process of the process group
+func signalGroup(pgid int, sig syscall.Signal) error {
+	if err := syscall.Kill(-pgid, sig); err != nil && !errors.Is(err, syscall.ESRCH) {
+		return fmt.Errorf("failed to signal process group: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,408 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// sandboxInitArg is the argv[0] of the executor binary re-executed inside the
+// namespaces to set up the sandbox before running the command
+const sandboxInitArg = "executor-sandbox-init"
+
+// sandboxPath is the PATH of the commands, the host's one is meaningless in the rootfs
+const sandboxPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// sandboxWorkspace is where the writable workspace is mounted in the sandbox
+const sandboxWorkspace = "/workspace"
+
+// sandboxHostname is the hostname seen by the commands
+const sandboxHostname = "sandbox"
+
+const (
+	prSetNoNewPrivs         = 38
+	linuxCapabilityVersion3 = 0x20080522
+)
+
+func init() {
+	if len(os.Args) > 0 && os.Args[0] == sandboxInitArg {
+		sandboxInit()
+	}
+}
+
+// SandboxExecutor runs commands in fresh user, mount, PID, network and UTS
+// namespaces, without a daemon. It needs a kernel allowing unprivileged user
+// namespaces when the executor does not run as root.
+//
+// The command sees the rootfs directory read-only as its root, Command.WorkDir
+// or a writable throwaway workspace as its working directory, a private /tmp, /proc and a
+// minimal /dev. It has no network but the loopback interface, runs as root
+// of its user namespace without any capability and is PID 1 of its PID
+// namespace, so everything it spawns is killed when it exits. Command.Image is
+// ignored, the rootfs plays its part. Of Command.Resources, only the size of
+// /tmp is enforced: the other limits need cgroups.
+//
+// The commands are set up by the executor binary itself, re-executed from
+// /proc/self/exe: the binary must import this package.
+type SandboxExecutor struct {
+	rootfs  string
+	baseDir string
+}
+
+var _ Executor = (*SandboxExecutor)(nil)
+
+// NewSandboxExecutor instance creator. The workspaces are created in baseDir,
+// the system temporary directory when empty.
+func NewSandboxExecutor(rootfs, baseDir string) (*SandboxExecutor, error) {
+	rootfs, err := filepath.Abs(rootfs)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(rootfs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rootfs: %v", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("invalid rootfs: %s is not a directory", rootfs)
+	}
+	return &SandboxExecutor{rootfs: rootfs, baseDir: baseDir}, nil
+}
+
+// Start sets up the sandbox and runs the command in it. Start returns once the
+// command is running, errors of the sandbox setup are returned by Start.
+func (se *SandboxExecutor) Start(ctx context.Context, cmd Command) (Handle, error) {
+	if len(cmd.Cmd) == 0 {
+		return nil, errors.New("empty command")
+	}
+
+	dir, err := os.MkdirTemp(se.baseDir, "sandbox-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sandbox directory: %v", err)
+	}
+	// root is the mount point of the sandbox root, only populated in its mount namespace
+	root, workspace := filepath.Join(dir, "root"), cmd.WorkDir
+	dirs := []string{root}
+	if workspace == "" {
+		workspace = filepath.Join(dir, "workspace")
+		dirs = append(dirs, workspace)
+	}
+	for _, d := range dirs {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("failed to create sandbox directory: %v", err)
+		}
+	}
+
+	// the init process reports setup errors on this pipe, which is closed
+	// without any data once the command is executed
+	errR, errW, err := os.Pipe()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	defer errR.Close()
+
+	c := &exec.Cmd{
+		Path: "/proc/self/exe",
+		Args: append([]string{sandboxInitArg, se.rootfs, root, workspace,
+			strconv.FormatInt(cmd.Resources.TmpfsSize, 10), "--"}, cmd.Cmd...),
+		Env:        sandboxEnv(cmd.Env),
+		ExtraFiles: []*os.File{errW},
+		SysProcAttr: &syscall.SysProcAttr{
+			Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID |
+				syscall.CLONE_NEWNET | syscall.CLONE_NEWUTS,
+			UidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+			GidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+			GidMappingsEnableSetgroups: false,
+			Pdeathsig:                  syscall.SIGKILL,
+		},
+	}
+
+	// killing the init of the PID namespace kills every process in it. It only
+	// receives SIGTERM if it handles it, otherwise it is killed after the grace period.
+	signal := func(pid int, sig syscall.Signal) error {
+		if err := syscall.Kill(pid, sig); err != nil && !errors.Is(err, syscall.ESRCH) {
+			return fmt.Errorf("failed to signal sandbox: %v", err)
+		}
+		return nil
+	}
+
+	h, err := startProcess(ctx, c, cmd, signal, func(int) { os.RemoveAll(dir) })
+	errW.Close()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	setupErr, err := io.ReadAll(errR)
+	if err != nil || len(setupErr) > 0 {
+		h.Cancel()
+		go io.Copy(io.Discard, h.Stdout())
+		go io.Copy(io.Discard, h.Stderr())
+		h.Wait()
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up sandbox: %v", err)
+		}
+		return nil, fmt.Errorf("failed to set up sandbox: %s", setupErr)
+	}
+
+	return h, nil
+}
+
+// CopyFrom archives cmd.WorkDir, which is bind-mounted into the sandboxes
+func (se *SandboxExecutor) CopyFrom(ctx context.Context, cmd Command) (io.ReadCloser, error) {
+	return archiveDir(cmd.WorkDir)
+}
+
+// sandboxEnv returns the environment of a command run in the sandbox
+func sandboxEnv(env map[string]string) []string {
+	base := map[string]string{
+		"PATH":   sandboxPath,
+		"HOME":   sandboxWorkspace,
+		"TMPDIR": "/tmp",
+	}
+	for name, value := range env {
+		base[name] = value
+	}
+	return envList(base)
+}
+
+// sandboxInit runs in the re-executed binary, in the new namespaces: it sets
+// up the sandbox then replaces itself with the command. It never returns.
+func sandboxInit() {
+	// credentials are per thread, the one dropping them must be the one calling exec
+	runtime.LockOSThread()
+
+	errPipe := os.NewFile(3, "sandbox-errors")
+	fail := func(err error) {
+		fmt.Fprint(errPipe, err)
+		os.Exit(1)
+	}
+
+	args := os.Args
+	if len(args) < 7 || args[5] != "--" {
+		fail(fmt.Errorf("invalid sandbox arguments %q", args))
+	}
+	rootfs, root, workspace, command := args[1], args[2], args[3], args[6:]
+	tmpfsSize, err := strconv.ParseInt(args[4], 10, 64)
+	if err != nil {
+		fail(fmt.Errorf("invalid tmpfs size: %v", err))
+	}
+
+	if err := setupSandbox(rootfs, root, workspace, tmpfsSize); err != nil {
+		fail(err)
+	}
+
+	path, err := exec.LookPath(command[0])
+	if err != nil {
+		fail(err)
+	}
+	if err := dropPrivileges(); err != nil {
+		fail(err)
+	}
+
+	syscall.CloseOnExec(3)
+	if err := syscall.Exec(path, command, os.Environ()); err != nil {
+		fail(fmt.Errorf("exec %s: %v", command[0], err))
+	}
+}
+
+// setupSandbox builds the sandbox root on a tmpfs mounted on root: the entries
+// of rootfs are bind mounted read-only, the workspace read-write, then root
+// becomes the root of the mount namespace. /tmp is limited to tmpfsSize bytes
+// when it is not zero.
+func setupSandbox(rootfs, root, workspace string, tmpfsSize int64) error {
+	// keep the mounts below from propagating to the host
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make mounts private: %v", err)
+	}
+	if err := syscall.Mount("tmpfs", root, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=755"); err != nil {
+		return fmt.Errorf("mount root: %v", err)
+	}
+
+	entries, err := os.ReadDir(rootfs)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		switch entry.Name() {
+		case "proc", "sys", "dev", "tmp", strings.TrimPrefix(sandboxWorkspace, "/"):
+			continue
+		}
+		if err := bindReadOnly(filepath.Join(rootfs, entry.Name()), filepath.Join(root, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	for _, d := range []string{"proc", "dev", "tmp", sandboxWorkspace} {
+		if err := os.Mkdir(filepath.Join(root, d), 0o755); err != nil {
+			return err
+		}
+	}
+	if err := syscall.Mount(workspace, filepath.Join(root, sandboxWorkspace), "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return fmt.Errorf("mount workspace: %v", err)
+	}
+	if err := syscall.Mount("proc", filepath.Join(root, "proc"), "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("mount /proc: %v", err)
+	}
+	tmpOptions := "mode=1777"
+	if tmpfsSize > 0 {
+		tmpOptions += fmt.Sprintf(",size=%d", tmpfsSize)
+	}
+	if err := syscall.Mount("tmpfs", filepath.Join(root, "tmp"), "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, tmpOptions); err != nil {
+		return fmt.Errorf("mount /tmp: %v", err)
+	}
+	if err := setupDev(filepath.Join(root, "dev")); err != nil {
+		return err
+	}
+
+	if err := syscall.Sethostname([]byte(sandboxHostname)); err != nil {
+		return fmt.Errorf("set hostname: %v", err)
+	}
+
+	// stack root on top of the old root, then detach the old root from under it
+	if err := os.Chdir(root); err != nil {
+		return err
+	}
+	if err := syscall.PivotRoot(".", "."); err != nil {
+		return fmt.Errorf("pivot root: %v", err)
+	}
+	if err := syscall.Unmount(".", syscall.MNT_DETACH); err != nil {
+		return fmt.Errorf("detach old root: %v", err)
+	}
+	if err := syscall.Mount("", "/", "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY|syscall.MS_NOSUID|syscall.MS_NODEV, ""); err != nil {
+		return fmt.Errorf("remount root read-only: %v", err)
+	}
+
+	return os.Chdir(sandboxWorkspace)
+}
+
+// bindReadOnly bind mounts src on dst, which is created, read-only. Symbolic
+// links are copied rather than mounted.
+func bindReadOnly(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, dst)
+	case info.IsDir():
+		err = os.Mkdir(dst, 0o755)
+	default:
+		err = createFile(dst)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := syscall.Mount(src, dst, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return fmt.Errorf("bind mount %s: %v", src, err)
+	}
+
+	// the flags locked on the source mount must be kept by the remount
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dst, &st); err != nil {
+		return err
+	}
+	flags := uintptr(syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY)
+	for stFlag, msFlag := range map[int64]uintptr{
+		0x2:    syscall.MS_NOSUID,
+		0x4:    syscall.MS_NODEV,
+		0x8:    syscall.MS_NOEXEC,
+		0x400:  syscall.MS_NOATIME,
+		0x800:  syscall.MS_NODIRATIME,
+		0x1000: syscall.MS_RELATIME,
+	} {
+		if st.Flags&stFlag != 0 {
+			flags |= msFlag
+		}
+	}
+	if err := syscall.Mount("", dst, "", flags, ""); err != nil {
+		return fmt.Errorf("remount %s read-only: %v", src, err)
+	}
+	return nil
+}
+
+// setupDev mounts a tmpfs on dir with the usual device nodes bound from the host
+func setupDev(dir string) error {
+	if err := syscall.Mount("tmpfs", dir, "tmpfs", syscall.MS_NOSUID, "mode=755"); err != nil {
+		return fmt.Errorf("mount /dev: %v", err)
+	}
+
+	for _, device := range []string{"null", "zero", "full", "random", "urandom", "tty"} {
+		dst := filepath.Join(dir, device)
+		if err := createFile(dst); err != nil {
+			return err
+		}
+		if err := syscall.Mount(filepath.Join("/dev", device), dst, "", syscall.MS_BIND, ""); err != nil {
+			return fmt.Errorf("mount /dev/%s: %v", device, err)
+		}
+	}
+
+	links := map[string]string{
+		"fd":     "/proc/self/fd",
+		"stdin":  "/proc/self/fd/0",
+		"stdout": "/proc/self/fd/1",
+		"stderr": "/proc/self/fd/2",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func createFile(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// dropPrivileges empties the capability sets, so that the command runs without
+// capabilities even as root of its user namespace, and prevents it from gaining
+// privileges through setuid binaries.
+func dropPrivileges() error {
+	for c := uintptr(0); ; c++ {
+		_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_CAPBSET_DROP, c, 0)
+		if errno == syscall.EINVAL {
+			// past the last capability known to the kernel
+			break
+		}
+		if errno != 0 {
+			return fmt.Errorf("drop capability %d: %v", c, errno)
+		}
+	}
+
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return fmt.Errorf("set no_new_privs: %v", errno)
+	}
+
+	// root keeps its inheritable capabilities across exec, clear every set
+	header := struct {
+		version uint32
+		pid     int32
+	}{version: linuxCapabilityVersion3}
+	var sets [2]struct{ effective, permitted, inheritable uint32 }
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_CAPSET, uintptr(unsafe.Pointer(&header)), uintptr(unsafe.Pointer(&sets[0])), 0); errno != 0 {
+		return fmt.Errorf("clear capabilities: %v", errno)
+	}
+	return nil
+}
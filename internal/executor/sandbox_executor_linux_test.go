@@ -0,0 +1,125 @@
+package executor_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	. "gertanoh.job-scheduler/internal/executor"
+)
+
+// newTestSandbox returns a sandbox using the host root as its rootfs, skipping
+// the test when the kernel does not allow the namespaces
+func newTestSandbox(t *testing.T) *SandboxExecutor {
+	t.Helper()
+
+	se, err := NewSandboxExecutor("/", t.TempDir())
+	if err != nil {
+		t.Fatalf("NewSandboxExecutor() unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := Run(ctx, se, Command{Cmd: []string{"true"}}, &bytes.Buffer{}, &bytes.Buffer{}); err != nil {
+		t.Skipf("namespaces unavailable: %v", err)
+	}
+	return se
+}
+
+func TestSandboxExecutor(t *testing.T) {
+	testExecutor(t, newTestSandbox(t), "")
+}
+
+func TestSandboxExecutorIsolation(t *testing.T) {
+	se := newTestSandbox(t)
+
+	t.Setenv("EXECUTOR_TEST_SECRET", "secret")
+
+	tests := []struct {
+		name       string
+		script     string
+		resources  Resources
+		wantStdout string
+	}{
+		{
+			name:       "PID namespace",
+			script:     `echo $$`,
+			wantStdout: "1\n",
+		},
+		{
+			name:       "UTS namespace",
+			script:     `cat /proc/sys/kernel/hostname`,
+			wantStdout: "sandbox\n",
+		},
+		{
+			name:       "Network namespace",
+			script:     `tail -n +3 /proc/net/dev | cut -d: -f1 | tr -d ' '`,
+			wantStdout: "lo\n",
+		},
+		{
+			name:       "Read-only rootfs",
+			script:     `touch /etc/sandbox-test 2>/dev/null || echo read-only`,
+			wantStdout: "read-only\n",
+		},
+		{
+			name:       "Writable workspace",
+			script:     `touch file && ls && pwd && echo "$HOME"`,
+			wantStdout: "file\n/workspace\n/workspace\n",
+		},
+		{
+			name:       "Writable tmp",
+			script:     `touch /tmp/file && echo ok`,
+			wantStdout: "ok\n",
+		},
+		{
+			name:       "Tmpfs size",
+			script:     `head -c 2097152 /dev/zero > /tmp/file 2>/dev/null || echo full`,
+			resources:  Resources{TmpfsSize: 1 << 20},
+			wantStdout: "full\n",
+		},
+		{
+			name:       "Environment scrubbed",
+			script:     `echo "${EXECUTOR_TEST_SECRET:-unset}"`,
+			wantStdout: "unset\n",
+		},
+		{
+			name:       "No capabilities",
+			script:     `grep CapEff /proc/self/status | cut -f2`,
+			wantStdout: "0000000000000000\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			var stdout, stderr bytes.Buffer
+			result, err := Run(ctx, se, Command{Cmd: []string{"sh", "-c", tt.script}, Resources: tt.resources}, &stdout, &stderr)
+			if err != nil {
+				t.Fatalf("Run() unexpected error: %v", err)
+			}
+			if result.ExitCode != 0 {
+				t.Fatalf("Run() exit code = %d, stderr %q", result.ExitCode, stderr.String())
+			}
+			if stdout.String() != tt.wantStdout {
+				t.Errorf("Run() stdout = %q, want %q", stdout.String(), tt.wantStdout)
+			}
+		})
+	}
+
+	if _, err := os.Stat("/etc/sandbox-test"); err == nil {
+		t.Errorf("the sandbox wrote to the host rootfs")
+	}
+}
+
+func TestSandboxExecutorUnknownCommand(t *testing.T) {
+	se := newTestSandbox(t)
+
+	_, err := se.Start(context.Background(), Command{Cmd: []string{"no-such-command"}})
+	if err == nil {
+		t.Fatal("Start() expected an error for an unknown command")
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !linux
+
+package executor
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// SandboxExecutor runs commands in Linux namespaces, it is not available on this platform
+type SandboxExecutor struct{}
+
+var _ Executor = (*SandboxExecutor)(nil)
+
+// NewSandboxExecutor fails outside of Linux
+func NewSandboxExecutor(rootfs, baseDir string) (*SandboxExecutor, error) {
+	return nil, errors.New("the sandbox executor requires Linux")
+}
+
+func (se *SandboxExecutor) Start(ctx context.Context, cmd Command) (Handle, error) {
+	return nil, errors.New("the sandbox executor requires Linux")
+}
+
+func (se *SandboxExecutor) CopyFrom(ctx context.Context, cmd Command) (io.ReadCloser, error) {
+	return nil, errors.New("the sandbox executor requires Linux")
+}
@@ -0,0 +1,217 @@
+// Package gotest parses the events printed by `go test -json` into the results
+// of the packages, tests and subtests that ran.
+package gotest
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+const (
+	Pass = "pass"
+	Fail = "fail"
+	Skip = "skip"
+)
+
+const (
+	KindPackage = "package"
+	KindTest    = "test"
+	KindSubtest = "subtest"
+)
+
+// MaxOutputLength bounds the output kept for a result, the end of a longer
+// output is kept as it is where the failure is reported
+const MaxOutputLength = 64 << 10
+
+// maxEventLength bounds the lines the parser decodes, longer lines are ignored
+const maxEventLength = 1 << 20
+
+// Result is the outcome of a package, a test or a subtest
+type Result struct {
+	Package string
+	// Test is the name of the test, subtests included as TestName/subtest.
+	// It is empty for the result of the package.
+	Test    string
+	Status  string
+	Elapsed time.Duration
+	// Output is the output of a failed result, empty otherwise
+	Output string
+}
+
+// Kind returns whether the result is the one of a package, a test or a subtest
+func (r Result) Kind() string {
+	switch {
+	case r.Test == "":
+		return KindPackage
+	case strings.Contains(r.Test, "/"):
+		return KindSubtest
+	default:
+		return KindTest
+	}
+}
+
+// event is a line of the output of `go test -json`, see `go doc test2json`
+type event struct {
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+	// ImportPath is the package of the build events, FailedBuild the package
+	// whose build failed a test package
+	ImportPath  string
+	FailedBuild string
+}
+
+type key struct {
+	pkg  string
+	test string
+}
+
+// Parser is a writer of the output of `go test -json`, which can be mixed with
+// other output: the lines that are not test events are ignored. The tests of a
+// package run several times, e.g. with -count, are reported once, as failed if
+// one of their runs failed.
+type Parser struct {
+	buf     []byte
+	skipped bool
+
+	results []*result
+	index   map[key]*result
+	// builds holds the output of the package builds, by import path
+	builds map[string][]byte
+}
+
+type result struct {
+	Result
+	done   bool
+	failed bool
+	output []byte
+}
+
+// NewParser instance creator
+func NewParser() *Parser {
+	return &Parser{index: map[key]*result{}, builds: map[string][]byte{}}
+}
+
+// Write never fails, the output that is not made of test events is ignored
+func (p *Parser) Write(b []byte) (int, error) {
+	n := len(b)
+	for len(b) > 0 {
+		end := bytes.IndexByte(b, '\n')
+		if end < 0 {
+			p.append(b)
+			break
+		}
+		p.append(b[:end])
+		if !p.skipped {
+			p.parse(p.buf)
+		}
+		p.buf, p.skipped = p.buf[:0], false
+		b = b[end+1:]
+	}
+	return n, nil
+}
+
+// append adds to the current line, a line too long for an event is skipped
+func (p *Parser) append(b []byte) {
+	if p.skipped {
+		return
+	}
+	if len(p.buf)+len(b) > maxEventLength {
+		p.buf, p.skipped = p.buf[:0], true
+		return
+	}
+	p.buf = append(p.buf, b...)
+}
+
+func (p *Parser) parse(line []byte) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 || line[0] != '{' {
+		return
+	}
+	var e event
+	if err := json.Unmarshal(line, &e); err != nil {
+		return
+	}
+
+	switch e.Action {
+	case "build-output":
+		p.builds[e.ImportPath] = appendOutput(p.builds[e.ImportPath], e.Output)
+		return
+	case "":
+		return
+	}
+	if e.Package == "" {
+		return
+	}
+
+	r := p.result(e.Package, e.Test)
+	switch e.Action {
+	case "output":
+		r.output = appendOutput(r.output, e.Output)
+	case Pass, Skip, Fail:
+		elapsed := time.Duration(e.Elapsed * float64(time.Second))
+		if r.done {
+			// a test run again, e.g. with -count
+			elapsed += r.Elapsed
+		}
+		r.done, r.Elapsed = true, elapsed
+		if e.Action == Fail {
+			r.failed = true
+			if build, ok := p.builds[e.FailedBuild]; ok {
+				r.output = append(append([]byte{}, build...), r.output...)
+			}
+		}
+		switch {
+		case r.failed:
+			r.Status = Fail
+		case r.Status != Pass:
+			r.Status = e.Action
+		}
+		if !r.failed {
+			r.output = nil
+		}
+	}
+}
+
+func (p *Parser) result(pkg, test string) *result {
+	k := key{pkg: pkg, test: test}
+	r, ok := p.index[k]
+	if !ok {
+		r = &result{Result: Result{Package: pkg, Test: test}}
+		p.index[k] = r
+		p.results = append(p.results, r)
+	}
+	return r
+}
+
+// Results returns the results in the order the packages and tests started.
+// The tests that did not end, e.g. because the step was stopped or the test
+// binary panicked, are reported as failed.
+func (p *Parser) Results() []Result {
+	results := make([]Result, 0, len(p.results))
+	for _, r := range p.results {
+		res := r.Result
+		if !r.done {
+			res.Status = Fail
+			r.failed = true
+		}
+		if r.failed {
+			res.Output = string(r.output)
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// appendOutput appends s to the output, keeping its last MaxOutputLength bytes
+func appendOutput(output []byte, s string) []byte {
+	output = append(output, s...)
+	if extra := len(output) - MaxOutputLength; extra > 0 {
+		output = append(output[:0], output[extra:]...)
+	}
+	return output
+}
@@ -0,0 +1,133 @@
+package gotest_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	. "gertanoh.job-scheduler/internal/gotest"
+)
+
+func TestParser(t *testing.T) {
+	output, err := os.ReadFile("testdata/go-test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// chunk is the size of the writes of the output, in one write when zero
+		chunk int
+	}{
+		{name: "Single write"},
+		{name: "Split writes", chunk: 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewParser()
+			// the output of the test commands is mixed with the output of the step
+			write(t, p, []byte("go: downloading example.com/dep v1.0.0\n{not an event}\n"), tt.chunk)
+			write(t, p, output, tt.chunk)
+
+			want := []struct {
+				pkg, test, kind, status, output string
+			}{
+				{pkg: "example.com/gt", kind: KindPackage, status: Fail, output: "FAIL\texample.com/gt"},
+				{pkg: "example.com/gt", test: "TestPass", kind: KindTest, status: Pass},
+				{pkg: "example.com/gt", test: "TestFail", kind: KindTest, status: Fail, output: "--- FAIL: TestFail"},
+				{pkg: "example.com/gt", test: "TestFail/sub_ok", kind: KindSubtest, status: Pass},
+				{pkg: "example.com/gt", test: "TestFail/sub_bad", kind: KindSubtest, status: Fail, output: "a_test.go:4: boom"},
+				{pkg: "example.com/gt", test: "TestSkip", kind: KindTest, status: Skip},
+				{pkg: "example.com/gt/broken", kind: KindPackage, status: Fail, output: "undefined: undefined"},
+			}
+
+			results := p.Results()
+			if len(results) != len(want) {
+				t.Fatalf("Results() = %+v, want %d results", results, len(want))
+			}
+			for i, w := range want {
+				r := results[i]
+				if r.Package != w.pkg || r.Test != w.test || r.Kind() != w.kind || r.Status != w.status {
+					t.Errorf("result %d = %s %q %s %s, want %s %q %s %s", i, r.Package, r.Test, r.Kind(), r.Status, w.pkg, w.test, w.kind, w.status)
+				}
+				if !strings.Contains(r.Output, w.output) || (w.output == "" && r.Output != "") {
+					t.Errorf("result %d output = %q, want it to contain %q", i, r.Output, w.output)
+				}
+			}
+			if results[0].Elapsed != 6*time.Millisecond {
+				t.Errorf("package elapsed = %s, want 6ms", results[0].Elapsed)
+			}
+		})
+	}
+}
+
+func TestParserInterrupted(t *testing.T) {
+	p := NewParser()
+	write(t, p, []byte(`{"Action":"start","Package":"example.com/slow"}
+{"Action":"run","Package":"example.com/slow","Test":"TestSlow"}
+{"Action":"output","Package":"example.com/slow","Test":"TestSlow","Output":"=== RUN   TestSlow\n"}
+`), 0)
+
+	results := p.Results()
+	if len(results) != 2 {
+		t.Fatalf("Results() = %+v, want the package and the test", results)
+	}
+	for _, r := range results {
+		if r.Status != Fail {
+			t.Errorf("status of %s %q = %s, want %s", r.Package, r.Test, r.Status, Fail)
+		}
+	}
+	if results[1].Output != "=== RUN   TestSlow\n" {
+		t.Errorf("output = %q, want the output of the test", results[1].Output)
+	}
+}
+
+func TestParserRepeatedRuns(t *testing.T) {
+	p := NewParser()
+	write(t, p, []byte(`{"Action":"run","Package":"example.com/p","Test":"TestFlaky"}
+{"Action":"output","Package":"example.com/p","Test":"TestFlaky","Output":"flaky_test.go:9: timeout\n"}
+{"Action":"fail","Package":"example.com/p","Test":"TestFlaky","Elapsed":0.5}
+{"Action":"run","Package":"example.com/p","Test":"TestFlaky"}
+{"Action":"pass","Package":"example.com/p","Test":"TestFlaky","Elapsed":0.25}
+`), 0)
+
+	results := p.Results()
+	if len(results) != 1 {
+		t.Fatalf("Results() = %+v, want a single result", results)
+	}
+	r := results[0]
+	if r.Status != Fail || r.Elapsed != 750*time.Millisecond || !strings.Contains(r.Output, "timeout") {
+		t.Errorf("result = %+v, want a failure of 750ms with the output of the failed run", r)
+	}
+}
+
+func TestParserOutputLimit(t *testing.T) {
+	p := NewParser()
+	line := `{"Action":"output","Package":"example.com/p","Test":"TestLoud","Output":"` + strings.Repeat("x", 1000) + `\n"}` + "\n"
+	write(t, p, []byte(strings.Repeat(line, 100)), 0)
+	write(t, p, []byte(`{"Action":"output","Package":"example.com/p","Test":"TestLoud","Output":"--- FAIL: TestLoud\n"}
+{"Action":"fail","Package":"example.com/p","Test":"TestLoud"}
+`), 0)
+
+	r := p.Results()[0]
+	if len(r.Output) != MaxOutputLength || !strings.HasSuffix(r.Output, "--- FAIL: TestLoud\n") {
+		t.Errorf("output of %d bytes, want the last %d bytes", len(r.Output), MaxOutputLength)
+	}
+}
+
+// write writes b to p by chunks of size chunk, or at once when zero
+func write(t *testing.T, p *Parser, b []byte, chunk int) {
+	t.Helper()
+	if chunk == 0 {
+		chunk = len(b)
+	}
+	for len(b) > 0 {
+		n := min(chunk, len(b))
+		if _, err := p.Write(b[:n]); err != nil {
+			t.Fatalf("Write() unexpected error: %v", err)
+		}
+		b = b[n:]
+	}
+}
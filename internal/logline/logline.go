@@ -0,0 +1,166 @@
+// Package logline defines the format of the execution logs: a JSON object per
+// line of output, with the stream and the step it comes from and the time it
+// was written.
+package logline
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	Stdout = "stdout"
+	Stderr = "stderr"
+	// System is the stream of the messages of the runner, like the step headers
+	System = "system"
+)
+
+// Streams lists the streams a line can come from
+var Streams = []string{Stdout, Stderr, System}
+
+// MaxLineLength splits the longer lines, so that the output of a command
+// printing without newlines is not held in memory
+const MaxLineLength = 64 << 10
+
+// maxEncodedLength bounds the size of an encoded line, escaping every byte
+const maxEncodedLength = 6*MaxLineLength + 1024
+
+// Line is a line of the logs
+type Line struct {
+	Time   time.Time `json:"t"`
+	Stream string    `json:"s"`
+	// Step is the index of the step that wrote the line, nil outside of the steps
+	Step *int   `json:"step,omitempty"`
+	Text string `json:"l"`
+}
+
+// Parse decodes a line of the logs. The logs stored before this format
+// existed are plain text, such a line is returned as it is, without stream.
+func Parse(raw []byte) Line {
+	var line Line
+	if err := json.Unmarshal(raw, &line); err != nil {
+		return Line{Text: string(bytes.TrimSuffix(raw, []byte("\n")))}
+	}
+	return line
+}
+
+// Scan calls fn with every line of r, raw and decoded, until fn returns an error
+func Scan(r io.Reader, fn func(raw []byte, line Line) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), maxEncodedLength)
+	for scanner.Scan() {
+		if err := fn(scanner.Bytes(), Parse(scanner.Bytes())); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// Filter selects lines by stream and step
+type Filter struct {
+	// Stream is the stream of the lines, any when empty
+	Stream string
+	// Step is the index of the step of the lines, any when nil
+	Step *int
+}
+
+// Match reports whether the line is selected by the filter
+func (f Filter) Match(line Line) bool {
+	if f.Stream != "" && line.Stream != f.Stream {
+		return false
+	}
+	if f.Step != nil && (line.Step == nil || *line.Step != *f.Step) {
+		return false
+	}
+	return true
+}
+
+// Writer splits what is written to it into lines, appended to the logs as
+// JSON lines. Each line is written with a single Write, so that writers of
+// different streams can share the logs when their writes are serialized.
+type Writer struct {
+	w      io.Writer
+	stream string
+	step   *int
+	now    func() time.Time
+
+	buf []byte
+	// start is the time the first byte of buf was written
+	start time.Time
+}
+
+// NewWriter returns a writer of the lines of a stream of a step, or of no step when nil
+func NewWriter(w io.Writer, stream string, step *int) *Writer {
+	return &Writer{w: w, stream: stream, step: step, now: time.Now}
+}
+
+func (lw *Writer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if len(lw.buf) == 0 {
+			lw.start = lw.now()
+		}
+
+		end := bytes.IndexByte(p, '\n')
+		newline := end >= 0
+		if !newline {
+			end = len(p)
+		}
+		if room := MaxLineLength - len(lw.buf); end > room {
+			end, newline = room, false
+		}
+
+		lw.buf = append(lw.buf, p[:end]...)
+		consumed := end
+		if newline {
+			consumed++
+		}
+		p = p[consumed:]
+
+		if newline || len(lw.buf) >= MaxLineLength {
+			if err := lw.writeLine(); err != nil {
+				return written, err
+			}
+		}
+		written += consumed
+	}
+	return written, nil
+}
+
+// Flush writes the last line when it does not end with a newline
+func (lw *Writer) Flush() error {
+	if len(lw.buf) == 0 {
+		return nil
+	}
+	return lw.writeLine()
+}
+
+func (lw *Writer) writeLine() error {
+	line := Line{
+		Time:   lw.start.UTC(),
+		Stream: lw.stream,
+		Step:   lw.step,
+		Text:   string(bytes.TrimSuffix(lw.buf, []byte("\r"))),
+	}
+	lw.buf = lw.buf[:0]
+
+	encoded, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	_, err = lw.w.Write(append(encoded, '\n'))
+	return err
+}
+
+// Printf writes a message of the runner to the logs, in the system stream
+func Printf(w io.Writer, step *int, format string, args ...interface{}) error {
+	lw := NewWriter(w, System, step)
+	if _, err := fmt.Fprintf(lw, format, args...); err != nil {
+		return err
+	}
+	return lw.Flush()
+}
@@ -0,0 +1,101 @@
+package logline_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "gertanoh.job-scheduler/internal/logline"
+)
+
+func TestWriter(t *testing.T) {
+	step := 2
+	long := strings.Repeat("x", MaxLineLength+10)
+
+	tests := []struct {
+		name   string
+		writes []string
+		want   []string
+	}{
+		{name: "Lines", writes: []string{"one\ntwo\n"}, want: []string{"one", "two"}},
+		{name: "Split writes", writes: []string{"o", "ne\ntw", "o\n"}, want: []string{"one", "two"}},
+		{name: "Unterminated line", writes: []string{"one\ntwo"}, want: []string{"one", "two"}},
+		{name: "Empty line", writes: []string{"\n\n"}, want: []string{"", ""}},
+		{name: "CRLF", writes: []string{"one\r\n"}, want: []string{"one"}},
+		{name: "Long line", writes: []string{long + "\n"}, want: []string{long[:MaxLineLength], long[MaxLineLength:]}},
+		{name: "Unicode", writes: []string{"caf\xc3", "\xa9\n"}, want: []string{"café"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			w := NewWriter(&logs, Stderr, &step)
+			for _, p := range tt.writes {
+				if n, err := w.Write([]byte(p)); err != nil || n != len(p) {
+					t.Fatalf("Write() = %d, %v, want %d", n, err, len(p))
+				}
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatalf("Flush() unexpected error: %v", err)
+			}
+
+			got := []string{}
+			err := Scan(&logs, func(raw []byte, line Line) error {
+				if line.Stream != Stderr || line.Step == nil || *line.Step != step || line.Time.IsZero() {
+					t.Errorf("line %s, want a timestamped stderr line of step %d", raw, step)
+				}
+				got = append(got, line.Text)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Scan() unexpected error: %v", err)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("lines = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilter(t *testing.T) {
+	zero, one := 0, 1
+	lines := []Line{
+		{Stream: System, Text: "checkout"},
+		{Stream: System, Step: &zero, Text: "header"},
+		{Stream: Stdout, Step: &zero, Text: "out"},
+		{Stream: Stderr, Step: &zero, Text: "err"},
+		{Stream: Stderr, Step: &one, Text: "err 2"},
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   string
+	}{
+		{name: "All", filter: Filter{}, want: "checkout|header|out|err|err 2"},
+		{name: "Stream", filter: Filter{Stream: Stderr}, want: "err|err 2"},
+		{name: "Step", filter: Filter{Step: &zero}, want: "header|out|err"},
+		{name: "Stream and step", filter: Filter{Stream: Stderr, Step: &one}, want: "err 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, line := range lines {
+				if tt.filter.Match(line) {
+					got = append(got, line.Text)
+				}
+			}
+			if strings.Join(got, "|") != tt.want {
+				t.Errorf("matched %q, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePlainText(t *testing.T) {
+	line := Parse([]byte("==> step 1 \"Build\"\n"))
+	if line.Text != `==> step 1 "Build"` || line.Stream != "" {
+		t.Errorf("Parse() = %+v, want the text without stream", line)
+	}
+}
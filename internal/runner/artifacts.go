@@ -0,0 +1,137 @@
+package runner
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"gertanoh.job-scheduler/internal/blobstore"
+)
+
+// ErrArtifacts is wrapped by the error of a run whose artifacts could not be stored
+var ErrArtifacts = errors.New("failed to store artifacts")
+
+// Artifact is a workspace file kept once the steps of a run are done
+type Artifact struct {
+	// Path is the slash separated path of the file in the workspace
+	Path   string
+	Size   int64
+	SHA256 string
+	// Key is where the content is kept in the blob store
+	Key string
+}
+
+// ArtifactKey returns the blob store key of an artifact content. Contents are
+// stored by checksum, so that a file kept by many runs is stored once.
+func ArtifactKey(sum string) string {
+	return "artifacts/sha256/" + sum[:2] + "/" + sum
+}
+
+// collectArtifacts stores the regular files of a tar archive of the workspace
+// matching one of the patterns, or inside a directory matching one of them.
+// Symbolic links and the .git directories are left out. The files are spooled
+// to tmpDir while their checksum is computed.
+func collectArtifacts(ctx context.Context, store blobstore.Store, archive io.Reader, tmpDir string, patterns []string) ([]Artifact, error) {
+	artifacts := []Artifact{}
+	tr := tar.NewReader(archive)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return artifacts, nil
+		}
+		if err != nil {
+			return artifacts, err
+		}
+		if err := ctx.Err(); err != nil {
+			return artifacts, err
+		}
+
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		if header.Typeflag != tar.TypeReg || inGitDir(name) || !matchArtifact(patterns, name) {
+			continue
+		}
+
+		artifact, err := storeArtifact(ctx, store, tr, tmpDir, name)
+		if err != nil {
+			return artifacts, fmt.Errorf("%s: %v", name, err)
+		}
+		artifacts = append(artifacts, artifact)
+	}
+}
+
+// inGitDir reports whether the file is inside a .git directory
+func inGitDir(name string) bool {
+	return slices.Contains(strings.Split(path.Dir(name), "/"), ".git")
+}
+
+// storeArtifact stores the content of a file under its checksum
+func storeArtifact(ctx context.Context, store blobstore.Store, content io.Reader, tmpDir, name string) (Artifact, error) {
+	f, err := os.CreateTemp(tmpDir, "artifact-")
+	if err != nil {
+		return Artifact{}, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(f, io.TeeReader(content, hash)); err != nil {
+		return Artifact{}, err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return Artifact{}, err
+	}
+
+	key := ArtifactKey(sum)
+	size, err := store.Put(ctx, key, f)
+	if err != nil {
+		return Artifact{}, err
+	}
+	return Artifact{Path: name, Size: size, SHA256: sum, Key: key}, nil
+}
+
+// matchArtifact reports whether the file, or one of its parent directories,
+// matches one of the patterns
+func matchArtifact(patterns []string, name string) bool {
+	segments := strings.Split(name, "/")
+	for _, pattern := range patterns {
+		patternSegments := strings.Split(strings.TrimSuffix(pattern, "/"), "/")
+		for i := len(segments); i > 0; i-- {
+			if matchSegments(patternSegments, segments[:i]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchSegments matches a path against a pattern, segment by segment. A **
+// segment matches any number of segments, the others follow path.Match.
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,330 @@
+// Package runner runs the steps of a job one after the other in a shared
+// workspace, through an executor, and reports the outcome of every step.
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gertanoh.job-scheduler/internal/blobstore"
+	"gertanoh.job-scheduler/internal/executor"
+	"gertanoh.job-scheduler/internal/gotest"
+	"gertanoh.job-scheduler/internal/logline"
+	"gertanoh.job-scheduler/internal/source"
+	"gertanoh.job-scheduler/internal/ymlparser"
+)
+
+const (
+	StepPending   = "pending"
+	StepRunning   = "running"
+	StepSucceeded = "succeeded"
+	StepFailed    = "failed"
+	// StepSkipped marks a step not run because an earlier step failed or the run was cancelled
+	StepSkipped   = "skipped"
+	StepCancelled = "cancelled"
+	StepTimedOut  = "timed_out"
+	// StepOOMKilled marks a step killed for exceeding the memory limit of the job
+	StepOOMKilled = "oom_killed"
+)
+
+// ErrTimedOut is wrapped by the error of a run stopped by the timeout of the job or of a step
+var ErrTimedOut = errors.New("timed out")
+
+// ErrOOMKilled is wrapped by the error of a run failed by a step killed for
+// exceeding the memory limit of the job
+var ErrOOMKilled = errors.New("killed for exceeding the memory limit")
+
+// ErrCheckout is wrapped by the error of a run whose source could not be checked out
+var ErrCheckout = errors.New("checkout failed")
+
+// cleanupTimeout bounds the steps marked always without a timeout of their own
+// when they run after the run was cancelled or timed out
+const cleanupTimeout = 5 * time.Minute
+
+// ErrExecutor is wrapped by the error of a run failed by a step the executor
+// could not carry out, rather than by a step exiting with a non-zero status
+var ErrExecutor = errors.New("executor error")
+
+// StepResult is the state of a step. Its output is the slice of the run logs
+// starting at LogOffset, LogLength bytes long, made of whole lines.
+type StepResult struct {
+	Index      int
+	Name       string
+	Status     string
+	ExitCode   *int
+	StartedAt  time.Time
+	FinishedAt time.Time
+	LogOffset  int64
+	LogLength  int64
+	// Reason explains a failure that is not a non-zero exit, e.g. an executor error
+	Reason string
+	// Tests are the results of the go test -json commands of the step
+	Tests []gotest.Result
+}
+
+// Duration returns how long the step ran
+func (sr *StepResult) Duration() time.Duration {
+	if sr.StartedAt.IsZero() || sr.FinishedAt.IsZero() {
+		return 0
+	}
+	return sr.FinishedAt.Sub(sr.StartedAt)
+}
+
+// Result is the outcome of a run
+type Result struct {
+	// Commit is the SHA of the commit checked out for the jobs with a source
+	Commit    string
+	Steps     []StepResult
+	Artifacts []Artifact
+}
+
+// Runner runs the steps of jobs. The workspace is a directory of the host the
+// runner runs on, where the source is checked out by the git command of the
+// host: the executor must give the steps access to it, the Docker executor
+// through a bind mount, which requires a local Docker daemon. The artifacts are
+// copied out of it through the executor, as the steps left it.
+type Runner struct {
+	executor  executor.Executor
+	image     string
+	baseDir   string
+	stopGrace time.Duration
+	store     blobstore.Store
+	// localRepos is the directory the local source repositories are fetched from
+	localRepos string
+}
+
+// New runner instance creator. Steps without an image run in image, the
+// workspaces are created in baseDir, the system temporary directory when empty.
+// Sources that are local repositories are only checked out from under
+// localRepos, never when it is empty.
+// A step stopped by a timeout or a cancellation has stopGrace to exit before it is killed.
+// The artifacts are stored in store, they are not collected when it is nil.
+func New(e executor.Executor, image, baseDir, localRepos string, stopGrace time.Duration, store blobstore.Store) *Runner {
+	return &Runner{executor: e, image: image, baseDir: baseDir, localRepos: localRepos, stopGrace: stopGrace, store: store}
+}
+
+// Run executes the steps of the job in order in a new workspace, writing their
+// output to logs in the logline format, and calls report every time a step starts or ends. The
+// source of the job, if any, is checked out in the workspace beforehand; when
+// the checkout fails only the steps marked always run. The workspace files
+// matching the artifact patterns of the job are stored afterwards, whatever the
+// outcome of the steps.
+//
+// Run stops at the first failing step: the following steps are skipped, except
+// the ones marked always, which run whatever happened before them. A failing
+// step marked continue_on_error does not stop the run. When the context is
+// cancelled or the job timeout elapsed the running step is stopped and the
+// remaining ones are skipped, except again the ones marked always. These run
+// detached from the cancellation, bounded by their own timeout or by
+// cleanupTimeout.
+//
+// The returned error describes the failure that failed the run, it is the
+// context error if the run was cancelled, wraps ErrTimedOut if it was
+// stopped by a timeout, ErrOOMKilled if a step exceeded the memory limit,
+// ErrCheckout if the source could not be checked out, ErrExecutor if the
+// executor failed to run a step and ErrArtifacts if the artifacts could not be stored.
+func (r *Runner) Run(ctx context.Context, job ymlparser.Job, logs io.Writer, report func(StepResult)) (Result, error) {
+	if job.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, time.Duration(job.Timeout), fmt.Errorf("job %w after %s", ErrTimedOut, job.Timeout))
+		defer cancel()
+	}
+
+	steps := job.Steps
+	run := Result{Steps: make([]StepResult, len(steps))}
+	results := run.Steps
+	for i, step := range steps {
+		results[i] = StepResult{Index: i, Name: step.Name, Status: StepPending}
+	}
+
+	workspace, err := os.MkdirTemp(r.baseDir, "workspace-")
+	if err != nil {
+		return run, fmt.Errorf("failed to create workspace: %v", err)
+	}
+	defer os.RemoveAll(workspace)
+
+	out := &countingWriter{w: logs}
+	var runErr error
+	if job.Source != nil {
+		logline.Printf(out, nil, "==> checkout %s\n", strings.TrimSpace(job.Source.Repo+" "+job.Source.Ref))
+		gitOutput := logline.NewWriter(out, logline.System, nil)
+		run.Commit, err = source.Checkout(ctx, *job.Source, workspace, r.localRepos, gitOutput)
+		gitOutput.Flush()
+		if err != nil && ctx.Err() == nil {
+			runErr = fmt.Errorf("%w: %v", ErrCheckout, err)
+		}
+	}
+
+	for i, step := range steps {
+		result := &results[i]
+
+		stopped := ctx.Err() != nil
+		if (stopped || runErr != nil) && !step.Always {
+			result.Status = StepSkipped
+			report(*result)
+			continue
+		}
+
+		stepCtx, cancel := ctx, context.CancelFunc(func() {})
+		if stopped {
+			stepCtx = context.WithoutCancel(ctx)
+			if step.Timeout == 0 {
+				stepCtx, cancel = context.WithTimeoutCause(stepCtx, cleanupTimeout,
+					fmt.Errorf("step %w after %s", ErrTimedOut, cleanupTimeout))
+			}
+		}
+		r.runStep(stepCtx, step, job.Resources, workspace, out, result, report)
+		cancel()
+
+		switch {
+		case stopped:
+			// the run already failed with the cause of the cancellation
+		case ctx.Err() != nil:
+			runErr = context.Cause(ctx)
+		case failed(result.Status) && !step.ContinueOnError && runErr == nil:
+			runErr = stepError(step, result)
+		}
+	}
+
+	if len(job.Artifacts) > 0 && r.store != nil {
+		logline.Printf(out, nil, "==> artifacts\n")
+		// a cancelled run still keeps what it produced
+		collectCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+		run.Artifacts, err = r.collectArtifacts(collectCtx, workspace, job.Artifacts)
+		cancel()
+		for _, artifact := range run.Artifacts {
+			logline.Printf(out, nil, "%s (%d bytes, sha256 %s)\n", artifact.Path, artifact.Size, artifact.SHA256)
+		}
+		if err != nil {
+			logline.Printf(out, nil, "%s: %v\n", ErrArtifacts, err)
+			if runErr == nil && ctx.Err() == nil {
+				runErr = fmt.Errorf("%w: %v", ErrArtifacts, err)
+			}
+		}
+	}
+
+	if runErr == nil && ctx.Err() != nil {
+		runErr = context.Cause(ctx)
+	}
+	return run, runErr
+}
+
+// collectArtifacts stores the artifacts of the workspace, copied from it through the executor
+func (r *Runner) collectArtifacts(ctx context.Context, workspace string, patterns []string) ([]Artifact, error) {
+	archive, err := r.executor.CopyFrom(ctx, executor.Command{Image: r.image, WorkDir: workspace})
+	if err != nil {
+		return []Artifact{}, err
+	}
+	defer archive.Close()
+	return collectArtifacts(ctx, r.store, archive, r.baseDir, patterns)
+}
+
+// runStep runs a single step within the resources of the job and records its outcome in result
+func (r *Runner) runStep(ctx context.Context, step ymlparser.Step, resources *ymlparser.Resources, workspace string, out *countingWriter, result *StepResult, report func(StepResult)) {
+	image := step.Image
+	if image == "" {
+		image = r.image
+	}
+	cmd := executor.Command{
+		Image:     image,
+		Cmd:       []string{"sh", "-c", step.Run},
+		Env:       step.Env,
+		WorkDir:   workspace,
+		Timeout:   time.Duration(step.Timeout),
+		StopGrace: r.stopGrace,
+	}
+	if resources != nil {
+		cmd.Resources = executor.Resources{
+			CPUs:      resources.CPUs,
+			Memory:    int64(resources.Memory),
+			PIDs:      resources.PIDs,
+			TmpfsSize: int64(resources.TmpfsSize),
+		}
+	}
+
+	result.Status = StepRunning
+	result.StartedAt = time.Now()
+	result.LogOffset = out.n
+	report(*result)
+
+	index := result.Index
+	logline.Printf(out, &index, "==> step %d %q\n", index+1, step.Name)
+	stdout := logline.NewWriter(out, logline.Stdout, &index)
+	stderr := logline.NewWriter(out, logline.Stderr, &index)
+	// the test events are parsed from the output of any step
+	tests := gotest.NewParser()
+	res, err := executor.Run(ctx, r.executor, cmd, io.MultiWriter(stdout, tests), stderr)
+	stdout.Flush()
+	stderr.Flush()
+
+	result.FinishedAt = time.Now()
+	result.LogLength = out.n - result.LogOffset
+	result.Tests = tests.Results()
+	switch {
+	case errors.Is(context.Cause(ctx), ErrTimedOut):
+		result.Status = StepTimedOut
+		result.Reason = context.Cause(ctx).Error()
+	case ctx.Err() != nil:
+		result.Status = StepCancelled
+	case err != nil:
+		result.Status = StepFailed
+		result.Reason = err.Error()
+	default:
+		result.ExitCode = &res.ExitCode
+		result.StartedAt, result.FinishedAt = res.StartedAt, res.FinishedAt
+		switch {
+		case res.TimedOut:
+			result.Status = StepTimedOut
+			result.Reason = fmt.Sprintf("step %s after %s", ErrTimedOut, step.Timeout)
+		case res.OOMKilled:
+			result.Status = StepOOMKilled
+			result.Reason = fmt.Sprintf("step %s", ErrOOMKilled)
+		case res.ExitCode == 0:
+			result.Status = StepSucceeded
+		default:
+			result.Status = StepFailed
+		}
+	}
+	report(*result)
+}
+
+// failed reports whether a step with this status fails the run
+func failed(status string) bool {
+	return status == StepFailed || status == StepTimedOut || status == StepOOMKilled
+}
+
+func stepError(step ymlparser.Step, result *StepResult) error {
+	switch result.Status {
+	case StepTimedOut:
+		return fmt.Errorf("step %d %q %w after %s", result.Index+1, step.Name, ErrTimedOut, step.Timeout)
+	case StepOOMKilled:
+		return fmt.Errorf("step %d %q %w", result.Index+1, step.Name, ErrOOMKilled)
+	}
+	if result.ExitCode == nil {
+		return fmt.Errorf("step %d %q failed: %w: %s", result.Index+1, step.Name, ErrExecutor, result.Reason)
+	}
+	return fmt.Errorf("step %d %q exited with status %d", result.Index+1, step.Name, *result.ExitCode)
+}
+
+// countingWriter counts the bytes written to the logs, to locate the output of
+// each step. The stdout and stderr of a step are written concurrently, writes
+// are serialized.
+type countingWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+	n  int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,421 @@
+package runner_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gertanoh.job-scheduler/internal/blobstore"
+	"gertanoh.job-scheduler/internal/executor"
+	"gertanoh.job-scheduler/internal/logline"
+	. "gertanoh.job-scheduler/internal/runner"
+	"gertanoh.job-scheduler/internal/ymlparser"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name         string
+		steps        []ymlparser.Step
+		wantStatuses []string
+		wantErr      string
+	}{
+		{
+			name: "All steps succeed",
+			steps: []ymlparser.Step{
+				{Name: "Build", Run: "echo built > artifact"},
+				{Name: "Test", Run: "cat artifact"},
+			},
+			wantStatuses: []string{StepSucceeded, StepSucceeded},
+		},
+		{
+			name: "Fail fast",
+			steps: []ymlparser.Step{
+				{Name: "Build", Run: "exit 2"},
+				{Name: "Test", Run: "true"},
+				{Name: "Cleanup", Run: "true", Always: true},
+			},
+			wantStatuses: []string{StepFailed, StepSkipped, StepSucceeded},
+			wantErr:      `step 1 "Build" exited with status 2`,
+		},
+		{
+			name: "Continue on error",
+			steps: []ymlparser.Step{
+				{Name: "Lint", Run: "exit 1", ContinueOnError: true},
+				{Name: "Test", Run: "true"},
+			},
+			wantStatuses: []string{StepFailed, StepSucceeded},
+		},
+		{
+			name: "Failing always step",
+			steps: []ymlparser.Step{
+				{Name: "Test", Run: "true"},
+				{Name: "Cleanup", Run: "exit 3", Always: true},
+			},
+			wantStatuses: []string{StepSucceeded, StepFailed},
+			wantErr:      `step 2 "Cleanup" exited with status 3`,
+		},
+		{
+			name: "First failure is reported",
+			steps: []ymlparser.Step{
+				{Name: "Build", Run: "exit 2"},
+				{Name: "Cleanup", Run: "exit 3", Always: true},
+			},
+			wantStatuses: []string{StepFailed, StepFailed},
+			wantErr:      `step 1 "Build" exited with status 2`,
+		},
+	}
+
+	r := New(executor.NewProcessExecutor(t.TempDir()), "", t.TempDir(), "", time.Second, nil)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			var logs bytes.Buffer
+			var reports int
+			run, err := r.Run(ctx, ymlparser.Job{Steps: tt.steps}, &logs, func(StepResult) { reports++ })
+			results := run.Steps
+
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("Run() unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+				t.Fatalf("Run() error = %v, want %q", err, tt.wantErr)
+			}
+
+			if len(results) != len(tt.wantStatuses) {
+				t.Fatalf("Run() returned %d results, want %d", len(results), len(tt.wantStatuses))
+			}
+			for i, result := range results {
+				if result.Status != tt.wantStatuses[i] {
+					t.Errorf("step %d status = %q, want %q", i, result.Status, tt.wantStatuses[i])
+				}
+			}
+			if reports == 0 {
+				t.Errorf("Run() did not report any step")
+			}
+		})
+	}
+}
+
+func TestRunLogOffsets(t *testing.T) {
+	r := New(executor.NewProcessExecutor(t.TempDir()), "", t.TempDir(), "", time.Second, nil)
+	steps := []ymlparser.Step{
+		{Name: "First", Run: "echo one"},
+		{Name: "Second", Run: "echo two >&2; exit 1"},
+	}
+
+	var logs bytes.Buffer
+	run, err := r.Run(context.Background(), ymlparser.Job{Steps: steps}, &logs, func(StepResult) {})
+	if err == nil {
+		t.Fatal("Run() expected an error")
+	}
+
+	streams := []string{logline.Stdout, logline.Stderr}
+	for i, want := range []string{"one", "two"} {
+		result := run.Steps[i]
+		output := logs.Bytes()[result.LogOffset : result.LogOffset+result.LogLength]
+		lines := []logline.Line{}
+		logline.Scan(bytes.NewReader(output), func(_ []byte, line logline.Line) error {
+			lines = append(lines, line)
+			return nil
+		})
+		if len(lines) != 2 || !strings.Contains(lines[0].Text, steps[i].Name) || lines[0].Stream != logline.System {
+			t.Fatalf("step %d output = %q, want the step header and its output", i, output)
+		}
+		if out := lines[1]; out.Text != want || out.Stream != streams[i] || out.Step == nil || *out.Step != i {
+			t.Errorf("step %d output line = %+v, want %q on %s", i, out, want, streams[i])
+		}
+		if result.ExitCode == nil {
+			t.Fatalf("step %d has no exit code", i)
+		}
+		if *result.ExitCode != i {
+			t.Errorf("step %d exit code = %d, want %d", i, *result.ExitCode, i)
+		}
+		if result.Duration() <= 0 {
+			t.Errorf("step %d duration = %v", i, result.Duration())
+		}
+	}
+}
+
+func TestRunTests(t *testing.T) {
+	r := New(executor.NewProcessExecutor(t.TempDir()), "", t.TempDir(), "", time.Second, nil)
+	events := `{"Action":"start","Package":"example.com/p"}
+{"Action":"run","Package":"example.com/p","Test":"TestA"}
+{"Action":"pass","Package":"example.com/p","Test":"TestA","Elapsed":0.01}
+{"Action":"fail","Package":"example.com/p","Elapsed":0.02}`
+	steps := []ymlparser.Step{
+		{Name: "Build", Run: "echo built"},
+		{Name: "Test", Run: "echo 'ok'; echo '" + strings.ReplaceAll(events, "\n", "'; echo '") + "'"},
+	}
+
+	run, err := r.Run(context.Background(), ymlparser.Job{Steps: steps}, io.Discard, func(StepResult) {})
+	if err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if len(run.Steps[0].Tests) != 0 {
+		t.Errorf("step 1 tests = %+v, want none", run.Steps[0].Tests)
+	}
+	tests := run.Steps[1].Tests
+	if len(tests) != 2 || tests[0].Status != "fail" || tests[1].Test != "TestA" || tests[1].Status != "pass" {
+		t.Errorf("step 2 tests = %+v, want the failed package and its passed test", tests)
+	}
+}
+
+// oomExecutor starts commands killed right away for exceeding their memory limit
+type oomExecutor struct{}
+
+func (oomExecutor) Start(ctx context.Context, cmd executor.Command) (executor.Handle, error) {
+	return oomHandle{at: time.Now()}, nil
+}
+
+func (oomExecutor) CopyFrom(ctx context.Context, cmd executor.Command) (io.ReadCloser, error) {
+	return nil, errors.New("no working directory")
+}
+
+type oomHandle struct {
+	at time.Time
+}
+
+func (oomHandle) Stdout() io.Reader       { return strings.NewReader("") }
+func (oomHandle) Stderr() io.Reader       { return strings.NewReader("") }
+func (oomHandle) Wait() error             { return nil }
+func (oomHandle) ExitCode() int           { return 137 }
+func (h oomHandle) StartedAt() time.Time  { return h.at }
+func (h oomHandle) FinishedAt() time.Time { return h.at }
+func (oomHandle) TimedOut() bool          { return false }
+func (oomHandle) OOMKilled() bool         { return true }
+func (oomHandle) Cancel() error           { return nil }
+
+func TestRunOOMKilled(t *testing.T) {
+	r := New(oomExecutor{}, "", t.TempDir(), "", time.Second, nil)
+	steps := []ymlparser.Step{
+		{Name: "Build", Run: "make"},
+		{Name: "Test", Run: "make test"},
+		{Name: "Cleanup", Run: "true", Always: true},
+	}
+
+	run, err := r.Run(context.Background(), ymlparser.Job{Steps: steps}, io.Discard, func(StepResult) {})
+	if !errors.Is(err, ErrOOMKilled) {
+		t.Fatalf("Run() error = %v, want %v", err, ErrOOMKilled)
+	}
+	want := []string{StepOOMKilled, StepSkipped, StepOOMKilled}
+	for i, result := range run.Steps {
+		if result.Status != want[i] {
+			t.Errorf("step %d status = %q, want %q", i, result.Status, want[i])
+		}
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	r := New(executor.NewProcessExecutor(t.TempDir()), "", t.TempDir(), "", time.Second, nil)
+	steps := []ymlparser.Step{
+		{Name: "Long", Run: "sleep 60"},
+		{Name: "Next", Run: "true"},
+		{Name: "Cleanup", Run: "true", Always: true},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	report := func(sr StepResult) {
+		if sr.Status == StepRunning {
+			cancel()
+		}
+	}
+
+	run, err := r.Run(ctx, ymlparser.Job{Steps: steps}, &bytes.Buffer{}, report)
+	if err != context.Canceled {
+		t.Fatalf("Run() error = %v, want %v", err, context.Canceled)
+	}
+	want := []string{StepCancelled, StepSkipped, StepSucceeded}
+	for i, result := range run.Steps {
+		if result.Status != want[i] {
+			t.Errorf("step %d status = %q, want %q", i, result.Status, want[i])
+		}
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	r := New(executor.NewProcessExecutor(t.TempDir()), "", t.TempDir(), "", time.Second, nil)
+
+	tests := []struct {
+		name         string
+		job          ymlparser.Job
+		wantStatuses []string
+		wantErr      string
+	}{
+		{
+			name: "Step timeout",
+			job: ymlparser.Job{Steps: []ymlparser.Step{
+				{Name: "Hang", Run: "echo partial; sleep 60", Timeout: ymlparser.Duration(200 * time.Millisecond)},
+				{Name: "Next", Run: "true"},
+				{Name: "Cleanup", Run: "true", Always: true},
+			}},
+			wantStatuses: []string{StepTimedOut, StepSkipped, StepSucceeded},
+			wantErr:      `step 1 "Hang" timed out after 200ms`,
+		},
+		{
+			name: "Job timeout",
+			job: ymlparser.Job{Timeout: ymlparser.Duration(200 * time.Millisecond), Steps: []ymlparser.Step{
+				{Name: "Hang", Run: "echo partial; sleep 60"},
+				{Name: "Next", Run: "true"},
+				{Name: "Cleanup", Run: "true", Always: true},
+			}},
+			wantStatuses: []string{StepTimedOut, StepSkipped, StepSucceeded},
+			wantErr:      "job timed out after 200ms",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			run, err := r.Run(context.Background(), tt.job, &logs, func(StepResult) {})
+
+			if !errors.Is(err, ErrTimedOut) || err.Error() != tt.wantErr {
+				t.Fatalf("Run() error = %v, want %q", err, tt.wantErr)
+			}
+			for i, result := range run.Steps {
+				if result.Status != tt.wantStatuses[i] {
+					t.Errorf("step %d status = %q, want %q", i, result.Status, tt.wantStatuses[i])
+				}
+			}
+			// the output written before the timeout is kept
+			if !strings.Contains(logs.String(), `"l":"partial"`) {
+				t.Errorf("Run() logs = %q, want the partial output", logs.String())
+			}
+		})
+	}
+}
+
+func TestRunSource(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+
+	repo := t.TempDir()
+	if err := os.WriteFile(filepath.Join(repo, "version.txt"), []byte("1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{{"init", "--quiet"}, {"add", "."}, {"commit", "--quiet", "-m", "first"}} {
+		if out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", args[0], err, out)
+		}
+	}
+	sha, err := exec.Command("git", "-C", repo, "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := New(executor.NewProcessExecutor(t.TempDir()), "", t.TempDir(), repo, time.Second, nil)
+
+	tests := []struct {
+		name         string
+		source       ymlparser.Source
+		wantCommit   string
+		wantStatuses []string
+		wantErr      error
+	}{
+		{
+			name:         "Checked out before the first step",
+			source:       ymlparser.Source{Repo: repo, Depth: 1},
+			wantCommit:   strings.TrimSpace(string(sha)),
+			wantStatuses: []string{StepSucceeded, StepSucceeded},
+		},
+		{
+			name:         "Checkout failure",
+			source:       ymlparser.Source{Repo: filepath.Join(repo, "missing")},
+			wantStatuses: []string{StepSkipped, StepSucceeded},
+			wantErr:      ErrCheckout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := ymlparser.Job{
+				Source: &tt.source,
+				Steps: []ymlparser.Step{
+					{Name: "Read", Run: "grep -x 1 version.txt"},
+					{Name: "Cleanup", Run: "true", Always: true},
+				},
+			}
+
+			var logs bytes.Buffer
+			run, err := r.Run(context.Background(), job, &logs, func(StepResult) {})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Run() error = %v, want %v\n%s", err, tt.wantErr, logs.String())
+			}
+			if run.Commit != tt.wantCommit {
+				t.Errorf("Run() commit = %q, want %q", run.Commit, tt.wantCommit)
+			}
+			for i, result := range run.Steps {
+				if result.Status != tt.wantStatuses[i] {
+					t.Errorf("step %d status = %q, want %q", i, result.Status, tt.wantStatuses[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRunArtifacts(t *testing.T) {
+	store, err := blobstore.NewFileStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("NewFileStore() unexpected error: %v", err)
+	}
+	r := New(executor.NewProcessExecutor(t.TempDir()), "", t.TempDir(), "", time.Second, store)
+
+	job := ymlparser.Job{
+		Artifacts: []string{"bin", "**/report.xml", "*.log"},
+		Steps: []ymlparser.Step{
+			{Name: "Build", Run: "mkdir -p bin/tools pkg/a && echo app > bin/app && echo tool > bin/tools/tool"},
+			{Name: "Test", Run: "echo '<testsuite/>' > pkg/a/report.xml && echo skipped > pkg/a/other.xml && exit 1"},
+			{Name: "Logs", Run: "echo done > build.log && ln -s /etc/passwd link.log", Always: true},
+		},
+	}
+
+	run, err := r.Run(context.Background(), job, &bytes.Buffer{}, func(StepResult) {})
+	if err == nil || errors.Is(err, ErrArtifacts) {
+		t.Fatalf("Run() error = %v, want the failure of the Test step", err)
+	}
+
+	want := map[string]string{
+		"bin/app":          "app\n",
+		"bin/tools/tool":   "tool\n",
+		"pkg/a/report.xml": "<testsuite/>\n",
+		"build.log":        "done\n",
+	}
+	if len(run.Artifacts) != len(want) {
+		t.Fatalf("Run() artifacts = %+v, want %d of them", run.Artifacts, len(want))
+	}
+	for _, artifact := range run.Artifacts {
+		content, ok := want[artifact.Path]
+		if !ok {
+			t.Errorf("unexpected artifact %s", artifact.Path)
+			continue
+		}
+		if artifact.Size != int64(len(content)) || artifact.Key != ArtifactKey(artifact.SHA256) {
+			t.Errorf("artifact %s = %+v", artifact.Path, artifact)
+		}
+
+		blob, err := store.Get(context.Background(), artifact.Key)
+		if err != nil {
+			t.Fatalf("Get(%s) unexpected error: %v", artifact.Key, err)
+		}
+		got, _ := io.ReadAll(blob)
+		blob.Close()
+		if string(got) != content {
+			t.Errorf("artifact %s content = %q, want %q", artifact.Path, got, content)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// bounds describes the accepted range of a cron field and the names it understands.
+type bounds struct {
+	name     string
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	seconds = bounds{name: "second", min: 0, max: 59}
+	minutes = bounds{name: "minute", min: 0, max: 59}
+	hours   = bounds{name: "hour", min: 0, max: 23}
+	dom     = bounds{name: "day of month", min: 1, max: 31}
+	months  = bounds{name: "month", min: 1, max: 12, names: map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 7 is accepted as an alias for Sunday and folded onto 0 after parsing.
+	dow = bounds{name: "day of week", min: 0, max: 7, names: map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// starBit is set on a field parsed from "*" or "?" so that the day of month /
+// day of week matching can tell an unrestricted field from an explicit one.
+const starBit = 1 << 63
+
+var macros = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+// Parse parses a cron expression and returns the corresponding Schedule.
+//
+// Both the classic 5-field form (minute hour day-of-month month day-of-week)
+// and the 6-field form with a leading seconds field are accepted, as well as
+// the @yearly, @annually, @monthly, @weekly, @daily, @midnight and @hourly macros.
+// Each field supports "*", "?", single values, ranges (1-5), steps (*/15, 10-40/5, 5/10),
+// comma separated lists and the JAN-DEC / SUN-SAT names.
+func Parse(spec string) (*Schedule, error) {
+	expr := strings.TrimSpace(spec)
+	if expr == "" {
+		return nil, fmt.Errorf("empty schedule")
+	}
+
+	if strings.HasPrefix(expr, "@") {
+		expanded, ok := macros[strings.ToLower(expr)]
+		if !ok {
+			return nil, fmt.Errorf("unknown schedule macro %q", expr)
+		}
+		expr = expanded
+	}
+
+	fields := strings.Fields(expr)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("expected 5 or 6 fields in schedule %q, found %d", spec, len(fields))
+	}
+
+	s := &Schedule{spec: spec}
+	var err error
+	for i, field := range []struct {
+		b   bounds
+		dst *uint64
+	}{
+		{seconds, &s.second},
+		{minutes, &s.minute},
+		{hours, &s.hour},
+		{dom, &s.dom},
+		{months, &s.month},
+		{dow, &s.dow},
+	} {
+		if *field.dst, err = parseField(fields[i], field.b); err != nil {
+			return nil, err
+		}
+	}
+
+	// fold Sunday written as 7 onto 0
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+
+	return s, nil
+}
+
+// parseField parses a comma separated list of ranges into a bit set.
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, expr := range strings.Split(field, ",") {
+		r, err := parseRange(expr, b)
+		if err != nil {
+			return 0, err
+		}
+		bits |= r
+	}
+	return bits, nil
+}
+
+// parseRange parses a single "*", "a", "a-b", "*/n", "a/n" or "a-b/n" expression.
+func parseRange(expr string, b bounds) (uint64, error) {
+	if expr == "" {
+		return 0, fmt.Errorf("empty %s value", b.name)
+	}
+
+	var (
+		start, end, step uint
+		extra            uint64
+		err              error
+	)
+
+	rangeAndStep := strings.Split(expr, "/")
+	if len(rangeAndStep) > 2 {
+		return 0, fmt.Errorf("invalid %s value %q: too many slashes", b.name, expr)
+	}
+	lowAndHigh := strings.Split(rangeAndStep[0], "-")
+	if len(lowAndHigh) > 2 {
+		return 0, fmt.Errorf("invalid %s value %q: too many hyphens", b.name, expr)
+	}
+
+	if lowAndHigh[0] == "*" || lowAndHigh[0] == "?" {
+		if len(lowAndHigh) > 1 {
+			return 0, fmt.Errorf("invalid %s value %q", b.name, expr)
+		}
+		start, end = b.min, b.max
+		extra = starBit
+	} else {
+		if start, err = parseValue(lowAndHigh[0], b); err != nil {
+			return 0, err
+		}
+		end = start
+		if len(lowAndHigh) == 2 {
+			if end, err = parseValue(lowAndHigh[1], b); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	step = 1
+	if len(rangeAndStep) == 2 {
+		if step, err = parseNumber(rangeAndStep[1]); err != nil {
+			return 0, fmt.Errorf("invalid %s step in %q: %v", b.name, expr, err)
+		}
+		if step == 0 {
+			return 0, fmt.Errorf("invalid %s step in %q: step must be positive", b.name, expr)
+		}
+		// "a/n" means every n starting at a
+		if len(lowAndHigh) == 1 && extra == 0 {
+			end = b.max
+		}
+		// a stepped star is no longer unrestricted
+		extra = 0
+	}
+
+	if start > end {
+		return 0, fmt.Errorf("invalid %s range %q: %d is after %d", b.name, expr, start, end)
+	}
+
+	var bits uint64
+	for v := start; v <= end; v += step {
+		bits |= 1 << v
+	}
+	return bits | extra, nil
+}
+
+// parseValue parses a number or a name and checks it against the field bounds.
+func parseValue(s string, b bounds) (uint, error) {
+	if v, ok := b.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := parseNumber(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s value %q", b.name, s)
+	}
+	if v < b.min || v > b.max {
+		return 0, fmt.Errorf("%s value %d out of range [%d, %d]", b.name, v, b.min, b.max)
+	}
+	return v, nil
+}
+
+func parseNumber(s string) (uint, error) {
+	v, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return 0, err
+	}
+	return uint(v), nil
+}
@@ -0,0 +1,177 @@
+// Package schedule turns the cron expressions found in job specs into fire times.
+package schedule
+
+import (
+	"fmt"
+	"time"
+)
+
+// searchYears bounds how far Next looks ahead before giving up on a schedule
+// that can never fire, e.g. "0 0 30 2 *".
+const searchYears = 5
+
+// Schedule is a parsed cron expression. Each field is stored as a bit set
+// where bit n is set when the value n matches.
+type Schedule struct {
+	second, minute, hour, dom, month, dow uint64
+	spec                                  string
+}
+
+// String returns the expression the schedule was parsed from.
+func (s *Schedule) String() string {
+	return s.spec
+}
+
+// Next returns the first fire time strictly after the given instant, in the
+// location of after. The zero time is returned if the schedule never fires.
+//
+// The expression is matched against the wall clock of that location. Across
+// daylight saving time changes:
+//   - fire times falling in a skipped interval (02:30 when clocks jump from 02:00
+//     to 03:00) collapse into a single run at the end of the gap, 03:00;
+//   - fire times falling in a repeated interval (01:30 when clocks go back from
+//     02:00 to 01:00) run once, on their first occurrence.
+func (s *Schedule) Next(after time.Time) time.Time {
+	loc := after.Location()
+
+	// Walk the wall clock as a naive UTC time so that the field arithmetic
+	// never has to deal with offsets, then map the result back onto loc.
+	wall := wallClock(after)
+
+	for {
+		wall = s.nextWall(wall.Add(time.Second))
+		if wall.IsZero() {
+			return time.Time{}
+		}
+
+		// in a repeated interval the first occurrence may already be in the past
+		if t := resolve(wall, loc); t.After(after) {
+			return t
+		}
+	}
+}
+
+// NextN returns the next n fire times strictly after the given instant.
+// Fewer than n times are returned if the schedule stops firing.
+func (s *Schedule) NextN(after time.Time, n int) []time.Time {
+	times := make([]time.Time, 0, n)
+	for len(times) < n {
+		after = s.Next(after)
+		if after.IsZero() {
+			break
+		}
+		times = append(times, after)
+	}
+	return times
+}
+
+// resolve maps a wall clock time, given as a naive UTC time, onto an instant in loc.
+// A wall time skipped by a DST gap resolves to the end of the gap, a wall time
+// repeated by a DST overlap resolves to its first occurrence.
+func resolve(wall time.Time, loc *time.Location) time.Time {
+	t := time.Date(wall.Year(), wall.Month(), wall.Day(),
+		wall.Hour(), wall.Minute(), wall.Second(), 0, loc)
+
+	switch naive := wallClock(t); {
+	case naive.After(wall):
+		// normalised forward past a gap, which ends where t's zone starts
+		start, _ := t.ZoneBounds()
+		return start
+	case naive.Before(wall):
+		// normalised backward before a gap, which starts where t's zone ends
+		_, end := t.ZoneBounds()
+		return end
+	}
+
+	// the wall time exists, check whether it also existed under the previous
+	// offset, i.e. whether clocks went back at the start of t's zone
+	start, _ := t.ZoneBounds()
+	if start.IsZero() {
+		return t
+	}
+	_, offset := t.Zone()
+	_, prevOffset := start.Add(-time.Second).Zone()
+	if prevOffset > offset {
+		earlier := t.Add(-time.Duration(prevOffset-offset) * time.Second)
+		if wallClock(earlier).Equal(wall) {
+			return earlier
+		}
+	}
+	return t
+}
+
+// wallClock returns the wall clock of t as a naive UTC time.
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+}
+
+// nextWall returns the first wall clock time at or after t matching the
+// schedule. t must be a UTC time truncated to the second.
+func (s *Schedule) nextWall(t time.Time) time.Time {
+	yearLimit := t.Year() + searchYears
+
+wrap:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+
+	for 1<<uint(t.Month())&s.month == 0 {
+		t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		if t.Month() == time.January {
+			goto wrap
+		}
+	}
+
+	for !s.dayMatches(t) {
+		t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		if t.Day() == 1 {
+			goto wrap
+		}
+	}
+
+	for 1<<uint(t.Hour())&s.hour == 0 {
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, time.UTC)
+		if t.Hour() == 0 {
+			goto wrap
+		}
+	}
+
+	for 1<<uint(t.Minute())&s.minute == 0 {
+		t = t.Truncate(time.Minute).Add(time.Minute)
+		if t.Minute() == 0 {
+			goto wrap
+		}
+	}
+
+	for 1<<uint(t.Second())&s.second == 0 {
+		t = t.Add(time.Second)
+		if t.Second() == 0 {
+			goto wrap
+		}
+	}
+
+	return t
+}
+
+// dayMatches applies the usual cron rule: when both the day of month and the
+// day of week are restricted, a day matching either of them fires.
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := 1<<uint(t.Day())&s.dom != 0
+	dowMatch := 1<<uint(t.Weekday())&s.dow != 0
+	if s.dom&starBit != 0 || s.dow&starBit != 0 {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// LoadLocation returns the IANA time zone a job schedule is evaluated in.
+// An empty name means UTC. "Local" is refused as it depends on the host running the scheduler.
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	if name == "Local" {
+		return nil, fmt.Errorf("time zone %q is host dependent, use an IANA name such as Europe/Paris", name)
+	}
+	return time.LoadLocation(name)
+}
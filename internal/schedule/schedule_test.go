@@ -0,0 +1,223 @@
+package schedule_test
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	. "gertanoh.job-scheduler/internal/schedule"
+)
+
+func mustTime(t *testing.T, value string) time.Time {
+	t.Helper()
+	tm, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t.Fatalf("invalid test time %q: %v", value, err)
+	}
+	return tm
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr bool
+	}{
+		{name: "5 fields", spec: "0 0 * * *"},
+		{name: "6 fields", spec: "*/30 * * * * *"},
+		{name: "ranges steps and lists", spec: "0 10-40/5 8-18 1,15 * MON-FRI"},
+		{name: "names", spec: "0 12 * JAN,jul sun"},
+		{name: "sunday as 7", spec: "0 0 * * 7"},
+		{name: "question mark", spec: "0 0 0 ? * MON"},
+		{name: "macro", spec: "@daily"},
+		{name: "macro uppercase", spec: "@HOURLY"},
+		{name: "empty", spec: "", wantErr: true},
+		{name: "too few fields", spec: "0 0 *", wantErr: true},
+		{name: "too many fields", spec: "0 0 0 * * * *", wantErr: true},
+		{name: "unknown macro", spec: "@sometimes", wantErr: true},
+		{name: "minute out of range", spec: "60 * * * *", wantErr: true},
+		{name: "day of month zero", spec: "0 0 0 * *", wantErr: true},
+		{name: "reversed range", spec: "0 20-10 * * *", wantErr: true},
+		{name: "zero step", spec: "*/0 * * * *", wantErr: true},
+		{name: "bad name", spec: "0 0 * FOO *", wantErr: true},
+		{name: "empty list entry", spec: "0 1,,2 * * *", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		spec  string
+		after string
+		want  []string
+	}{
+		{
+			spec:  "0 0 * * *",
+			after: "2024-02-24T21:09:02Z",
+			want:  []string{"2024-02-25T00:00:00Z", "2024-02-26T00:00:00Z"},
+		},
+		{
+			spec:  "*/30 * * * * *",
+			after: "2024-02-24T21:09:02Z",
+			want:  []string{"2024-02-24T21:09:30Z", "2024-02-24T21:10:00Z", "2024-02-24T21:10:30Z"},
+		},
+		{
+			spec:  "0 10 * * *",
+			after: "2024-02-24T10:00:00Z",
+			want:  []string{"2024-02-25T10:00:00Z"},
+		},
+		{
+			spec:  "@hourly",
+			after: "2024-12-31T23:30:00Z",
+			want:  []string{"2025-01-01T00:00:00Z", "2025-01-01T01:00:00Z"},
+		},
+		{
+			spec:  "0 9 * * MON-FRI",
+			after: "2024-02-23T09:00:00Z", // a Friday
+			want:  []string{"2024-02-26T09:00:00Z", "2024-02-27T09:00:00Z"},
+		},
+		{
+			spec:  "0 0 29 2 *",
+			after: "2024-03-01T00:00:00Z",
+			want:  []string{"2028-02-29T00:00:00Z"},
+		},
+		{
+			// day of month and day of week both restricted: either matches
+			spec:  "0 0 13 * FRI",
+			after: "2024-09-01T00:00:00Z",
+			want:  []string{"2024-09-06T00:00:00Z", "2024-09-13T00:00:00Z", "2024-09-20T00:00:00Z"},
+		},
+		{
+			spec:  "0 15/20 * * * *",
+			after: "2024-02-24T21:36:00Z",
+			want:  []string{"2024-02-24T21:55:00Z", "2024-02-24T22:15:00Z"},
+		},
+		{
+			spec:  "@weekly",
+			after: "2024-02-24T21:09:02Z",
+			want:  []string{"2024-02-25T00:00:00Z", "2024-03-03T00:00:00Z"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := Parse(tt.spec)
+			if err != nil {
+				t.Fatalf("Parse(%q) unexpected error: %v", tt.spec, err)
+			}
+
+			got := s.NextN(mustTime(t, tt.after), len(tt.want))
+			if len(got) != len(tt.want) {
+				t.Fatalf("NextN() got %d times, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if want := mustTime(t, tt.want[i]); !got[i].Equal(want) {
+					t.Errorf("NextN()[%d] = %v, want %v", i, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestNextNever(t *testing.T) {
+	s, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("Parse() unexpected error: %v", err)
+	}
+
+	if got := s.Next(mustTime(t, "2024-01-01T00:00:00Z")); !got.IsZero() {
+		t.Errorf("Next() = %v, want zero time", got)
+	}
+}
+
+func TestNextInLocation(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("LoadLocation() unexpected error: %v", err)
+	}
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatalf("LoadLocation() unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		spec  string
+		loc   *time.Location
+		after string
+		want  []string
+	}{
+		{
+			name:  "midnight in the job zone",
+			spec:  "0 0 * * *",
+			loc:   paris,
+			after: "2024-02-24T21:09:02Z",
+			want:  []string{"2024-02-24T23:00:00Z", "2024-02-25T23:00:00Z"},
+		},
+		{
+			name:  "skipped time runs at the end of the gap",
+			spec:  "30 2 * * *",
+			loc:   newYork,
+			after: "2024-03-09T12:00:00Z",
+			want:  []string{"2024-03-10T07:00:00Z", "2024-03-11T06:30:00Z"},
+		},
+		{
+			name:  "times inside the gap collapse into one run",
+			spec:  "*/15 * * * *",
+			loc:   newYork,
+			after: "2024-03-10T06:50:00Z", // 01:50 EST
+			want:  []string{"2024-03-10T07:00:00Z", "2024-03-10T07:15:00Z", "2024-03-10T07:30:00Z"},
+		},
+		{
+			name:  "repeated time runs on its first occurrence only",
+			spec:  "30 1 * * *",
+			loc:   newYork,
+			after: "2024-11-02T12:00:00Z",
+			want:  []string{"2024-11-03T05:30:00Z", "2024-11-04T06:30:00Z"},
+		},
+		{
+			name:  "hourly across the repeated hour",
+			spec:  "0 * * * *",
+			loc:   newYork,
+			after: "2024-11-03T04:30:00Z", // 00:30 EDT
+			want:  []string{"2024-11-03T05:00:00Z", "2024-11-03T07:00:00Z", "2024-11-03T08:00:00Z"},
+		},
+		{
+			name:  "starting inside the second pass of the repeated hour",
+			spec:  "*/20 * * * *",
+			loc:   newYork,
+			after: "2024-11-03T06:10:00Z", // 01:10 EST
+			want:  []string{"2024-11-03T07:00:00Z"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.spec)
+			if err != nil {
+				t.Fatalf("Parse(%q) unexpected error: %v", tt.spec, err)
+			}
+
+			got := s.NextN(mustTime(t, tt.after).In(tt.loc), len(tt.want))
+			if len(got) != len(tt.want) {
+				t.Fatalf("NextN() got %d times, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if want := mustTime(t, tt.want[i]); !got[i].Equal(want) {
+					t.Errorf("NextN()[%d] = %v, want %v", i, got[i].UTC(), want)
+				}
+				if got[i].Location() != tt.loc {
+					t.Errorf("NextN()[%d] location = %v, want %v", i, got[i].Location(), tt.loc)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gertanoh.job-scheduler/internal/data"
+	"gertanoh.job-scheduler/internal/ymlparser"
+	"go.uber.org/zap"
+)
+
+// admit applies the job's concurrency policy before a new run is enqueued.
+// It returns false, with the reason, when the new run must be skipped.
+// With the Replace policy the in-flight runs are cancelled: queued runs are
+// removed from the queue and running ones are flagged for their executor to stop.
+//
+// Running executions whose lease expired are not in flight anymore: their
+// executor died, and FailExpired records them as failed.
+func (s *Scheduler) admit(tx data.Models, job *data.DueJob, now time.Time) (bool, string, error) {
+	if job.ConcurrencyPolicy != ymlparser.ConcurrencyForbid && job.ConcurrencyPolicy != ymlparser.ConcurrencyReplace {
+		return true, "", nil
+	}
+
+	executions, err := tx.JobExecutions.GetActiveForJob(job.JobID)
+	if err != nil {
+		return false, "", err
+	}
+	active := []*data.JobExecution{}
+	for _, execution := range executions {
+		if !execution.LeaseExpired(now, s.lease) {
+			active = append(active, execution)
+		}
+	}
+	if len(active) == 0 {
+		return true, "", nil
+	}
+
+	if job.ConcurrencyPolicy == ymlparser.ConcurrencyForbid {
+		reason := fmt.Sprintf("concurrency policy %s: execution %d is still %s",
+			job.ConcurrencyPolicy, active[0].ID, active[0].Status)
+		return false, reason, nil
+	}
+
+	for _, execution := range active {
+		if err := s.replace(tx, execution); err != nil {
+			return false, "", err
+		}
+	}
+	return true, "", nil
+}
+
+// replace cancels an in-flight execution superseded by a newer run.
+func (s *Scheduler) replace(tx data.Models, execution *data.JobExecution) error {
+	reason := fmt.Sprintf("concurrency policy %s: replaced by a newer run", ymlparser.ConcurrencyReplace)
+
+	status := execution.Status
+	err := tx.CancelExecution(execution, reason)
+	// the executor may have moved it on since it was read, it is then no longer in flight
+	if err != nil && !errors.Is(err, data.ErrInvalidTransition) {
+		return err
+	}
+	if err != nil || status == data.ExecutionCancelling {
+		return nil
+	}
+
+	s.logger.Info("Execution replaced",
+		zap.Int64("job_id", execution.JobID),
+		zap.Int64("execution_id", execution.ID),
+		zap.String("status", status))
+	return nil
+}
@@ -0,0 +1,120 @@
+package scheduler
+
+import (
+	"time"
+
+	"gertanoh.job-scheduler/internal/schedule"
+	"gertanoh.job-scheduler/internal/ymlparser"
+)
+
+// missedRunsLimit bounds the number of due runs handled for one job in a single
+// dispatch. Older runs are dropped so that a job firing every second does not
+// turn a long outage into an unbounded transaction, they are recorded as a
+// single skipped_misfire run.
+const missedRunsLimit = 1000
+
+// plan is the outcome of applying a job's misfire policy to its due runs.
+type plan struct {
+	fire []time.Time // runs to dispatch
+	skip []time.Time // runs to record as skipped_misfire
+	next time.Time   // first fire time after now, zero if the job will not run again
+
+	// droppedFirst and droppedLast are the fire times of the first and last
+	// due runs beyond missedRunsLimit, recorded together as a single skipped
+	// run. They are zero when no run is dropped.
+	droppedFirst, droppedLast time.Time
+}
+
+// planRuns lists the runs of a job due between its stored next execution, first,
+// and now, then decides which ones are dispatched according to the misfire policy.
+//
+// A run is missed when it is more than maxLateness late. Runs that are not late
+// are always dispatched. Missed runs are:
+//   - fire_all: all dispatched;
+//   - fire_once: collapsed into a single run when no run is on time, the others skipped;
+//   - skip: all skipped.
+func planRuns(sched *schedule.Schedule, first, now time.Time, runOnce bool, policy string, maxLateness time.Duration) plan {
+	var p plan
+
+	var due []time.Time
+	switch {
+	case runOnce:
+		if !first.After(now) {
+			due = []time.Time{first}
+		}
+	case !first.IsZero():
+		due, p.next, p.droppedFirst, p.droppedLast = dueRuns(sched, first, now, missedRunsLimit)
+	}
+
+	// due is sorted, the missed runs are a prefix of it
+	missed := 0
+	for missed < len(due) && now.Sub(due[missed]) > maxLateness {
+		missed++
+	}
+	late, onTime := due[:missed], due[missed:]
+
+	switch policy {
+	case ymlparser.MisfireFireAll:
+		p.fire = due
+	case ymlparser.MisfireSkip:
+		p.skip, p.fire = late, onTime
+	default:
+		if len(onTime) > 0 || len(late) == 0 {
+			p.skip, p.fire = late, onTime
+		} else {
+			p.skip, p.fire = late[:len(late)-1], late[len(late)-1:]
+		}
+	}
+
+	return p
+}
+
+// dueRuns returns the last fire times of sched from first to now, at most
+// limit of them, and the first fire time after now. The older fire times are
+// dropped, droppedFirst and droppedLast are the first and last of them.
+//
+// The fire times are listed from a window ending at now, doubled until it
+// holds more than limit runs or reaches first. The time spent does not grow
+// with the length of the outage, unlike listing every run from first: a job
+// firing every second and missed for a month would take 2.6M iterations, in
+// the transaction holding its schedule row.
+func dueRuns(sched *schedule.Schedule, first, now time.Time, limit int) (due []time.Time, next, droppedFirst, droppedLast time.Time) {
+	span := now.Sub(first)
+	window := span
+	if period := sched.Next(first).Sub(first); period > 0 && period < span/time.Duration(limit) {
+		window = period * time.Duration(limit)
+	}
+
+	for {
+		t := first
+		if window < span {
+			t = sched.Next(now.Add(-window))
+		}
+
+		// one run more than the limit, the last dropped one
+		due = due[:0]
+		for !t.IsZero() && !t.After(now) {
+			due = append(due, t)
+			if len(due) > 2*(limit+1) {
+				due = append(due[:0], due[len(due)-(limit+1):]...)
+			}
+			t = sched.Next(t)
+		}
+		next = t
+
+		if window >= span || len(due) > limit {
+			break
+		}
+		if window > span/2 {
+			window = span
+		} else {
+			window *= 2
+		}
+	}
+
+	if len(due) > limit {
+		droppedFirst, droppedLast = first, due[len(due)-limit-1]
+		due = due[len(due)-limit:]
+	}
+	return due, next, droppedFirst, droppedLast
+}
@@ -0,0 +1,169 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"gertanoh.job-scheduler/internal/schedule"
+	"gertanoh.job-scheduler/internal/ymlparser"
+)
+
+func TestPlanRuns(t *testing.T) {
+	hourly, err := schedule.Parse("0 * * * *")
+	if err != nil {
+		t.Fatalf("Parse() unexpected error: %v", err)
+	}
+
+	base := time.Date(2024, 2, 24, 10, 0, 0, 0, time.UTC)
+	at := func(hours int) time.Time { return base.Add(time.Duration(hours) * time.Hour) }
+
+	tests := []struct {
+		name     string
+		first    time.Time
+		now      time.Time
+		runOnce  bool
+		policy   string
+		wantFire []time.Time
+		wantSkip []time.Time
+		wantNext time.Time
+	}{
+		{
+			name:     "on time",
+			first:    at(0),
+			now:      at(0).Add(5 * time.Second),
+			policy:   ymlparser.MisfireFireOnce,
+			wantFire: []time.Time{at(0)},
+			wantNext: at(1),
+		},
+		{
+			name:     "fire all",
+			first:    at(0),
+			now:      at(3).Add(10 * time.Minute),
+			policy:   ymlparser.MisfireFireAll,
+			wantFire: []time.Time{at(0), at(1), at(2), at(3)},
+			wantNext: at(4),
+		},
+		{
+			name:     "fire once",
+			first:    at(0),
+			now:      at(3).Add(10 * time.Minute),
+			policy:   ymlparser.MisfireFireOnce,
+			wantFire: []time.Time{at(3)},
+			wantSkip: []time.Time{at(0), at(1), at(2)},
+			wantNext: at(4),
+		},
+		{
+			name:     "fire once with a run on time",
+			first:    at(0),
+			now:      at(3).Add(30 * time.Second),
+			policy:   ymlparser.MisfireFireOnce,
+			wantFire: []time.Time{at(3)},
+			wantSkip: []time.Time{at(0), at(1), at(2)},
+			wantNext: at(4),
+		},
+		{
+			name:     "skip",
+			first:    at(0),
+			now:      at(3).Add(10 * time.Minute),
+			policy:   ymlparser.MisfireSkip,
+			wantSkip: []time.Time{at(0), at(1), at(2), at(3)},
+			wantNext: at(4),
+		},
+		{
+			name:     "skip keeps the run on time",
+			first:    at(0),
+			now:      at(2).Add(30 * time.Second),
+			policy:   ymlparser.MisfireSkip,
+			wantFire: []time.Time{at(2)},
+			wantSkip: []time.Time{at(0), at(1)},
+			wantNext: at(3),
+		},
+		{
+			name:     "missed run once job fires",
+			first:    at(0),
+			now:      at(5),
+			runOnce:  true,
+			policy:   ymlparser.MisfireFireOnce,
+			wantFire: []time.Time{at(0)},
+		},
+		{
+			name:     "missed run once job skipped",
+			first:    at(0),
+			now:      at(5),
+			runOnce:  true,
+			policy:   ymlparser.MisfireSkip,
+			wantSkip: []time.Time{at(0)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := planRuns(hourly, tt.first, tt.now, tt.runOnce, tt.policy, time.Minute)
+
+			assertTimes(t, "fire", got.fire, tt.wantFire)
+			assertTimes(t, "skip", got.skip, tt.wantSkip)
+			if !got.next.Equal(tt.wantNext) {
+				t.Errorf("planRuns() next = %v, want %v", got.next, tt.wantNext)
+			}
+			if !got.droppedFirst.IsZero() {
+				t.Errorf("planRuns() dropped runs from %v, want none", got.droppedFirst)
+			}
+		})
+	}
+}
+
+func TestPlanRunsLimit(t *testing.T) {
+	everySecond, err := schedule.Parse("* * * * * *")
+	if err != nil {
+		t.Fatalf("Parse() unexpected error: %v", err)
+	}
+
+	first := time.Date(2024, 2, 24, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		now  time.Time
+	}{
+		// 3601 runs are due
+		{name: "Hour", now: first.Add(time.Hour)},
+		// 2.6M runs are due, only the last ones are listed
+		{name: "Month", now: first.Add(30 * 24 * time.Hour)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := planRuns(everySecond, first, tt.now, false, ymlparser.MisfireSkip, time.Minute)
+
+			// 61 runs are within the lateness window
+			if len(got.fire) != 61 {
+				t.Errorf("planRuns() fired %d runs, want 61", len(got.fire))
+			}
+			if len(got.skip)+len(got.fire) != missedRunsLimit {
+				t.Errorf("planRuns() handled %d runs, want %d", len(got.skip)+len(got.fire), missedRunsLimit)
+			}
+			if want := tt.now.Add(-(missedRunsLimit - 1) * time.Second); !got.skip[0].Equal(want) {
+				t.Errorf("planRuns() first skipped run = %v, want %v", got.skip[0], want)
+			}
+			wantLast := tt.now.Add(-missedRunsLimit * time.Second)
+			if !got.droppedFirst.Equal(first) || !got.droppedLast.Equal(wantLast) {
+				t.Errorf("planRuns() dropped runs from %v to %v, want from %v to %v", got.droppedFirst, got.droppedLast,
+					first, wantLast)
+			}
+			if want := tt.now.Add(time.Second); !got.next.Equal(want) {
+				t.Errorf("planRuns() next = %v, want %v", got.next, want)
+			}
+		})
+	}
+}
+
+func assertTimes(t *testing.T, name string, got, want []time.Time) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("planRuns() %s = %v, want %v", name, got, want)
+	}
+	for i := range got {
+		if !got[i].Equal(want[i]) {
+			t.Errorf("planRuns() %s[%d] = %v, want %v", name, i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// Package scheduler implements the enqueue service: it polls jobs_schedule for
+// due runs, records an execution for each of them, pushes it to the job queue
+// and advances the schedule. It also fails the running executions whose
+// executor stopped sending heartbeats.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gertanoh.job-scheduler/internal/data"
+	"gertanoh.job-scheduler/internal/schedule"
+	"go.uber.org/zap"
+)
+
+// Scheduler dispatches due jobs. Several instances can run against the same
+// database, due rows are locked while claimed so that a run is only dispatched once.
+type Scheduler struct {
+	models    data.Models
+	logger    *zap.Logger
+	interval  time.Duration
+	batchSize int
+	// lease is how long a running execution stays running without a heartbeat
+	// from its executor
+	lease time.Duration
+	now   func() time.Time
+}
+
+// New scheduler instance creator
+func New(models data.Models, logger *zap.Logger, interval time.Duration, batchSize int, lease time.Duration) *Scheduler {
+	return &Scheduler{
+		models:    models,
+		logger:    logger,
+		interval:  interval,
+		batchSize: batchSize,
+		lease:     lease,
+		now:       time.Now,
+	}
+}
+
+// Run fails the expired executions and polls the schedule every interval until
+// the context is cancelled.
+func (s *Scheduler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.FailExpired(); err != nil {
+			s.logger.Error("Failed to fail expired executions", zap.Error(err))
+		}
+		if err := s.DispatchDue(ctx); err != nil {
+			s.logger.Error("Failed to dispatch due jobs", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// FailExpired ends the running executions whose executor sent no heartbeat
+// for longer than the lease, e.g. because it died after claiming them, so that
+// they do not hold back the jobs whose concurrency policy is Forbid.
+func (s *Scheduler) FailExpired() error {
+	expired, err := s.models.JobExecutions.FailExpired(s.lease)
+	if err != nil {
+		return err
+	}
+
+	for _, execution := range expired {
+		s.logger.Warn("Execution lease expired",
+			zap.Int64("job_id", execution.JobID),
+			zap.Int64("execution_id", execution.ID),
+			zap.String("status", execution.Status))
+	}
+	return nil
+}
+
+// DispatchDue dispatches every job due at the current time, one batch per
+// transaction, until no due row is left.
+func (s *Scheduler) DispatchDue(ctx context.Context) error {
+	for ctx.Err() == nil {
+		n, err := s.dispatchBatch(ctx, s.now())
+		if err != nil {
+			return err
+		}
+		if n < s.batchSize {
+			return nil
+		}
+	}
+	return ctx.Err()
+}
+
+// dispatchBatch claims up to batchSize due rows and dispatches them in a single
+// transaction. It returns the number of claimed rows.
+func (s *Scheduler) dispatchBatch(ctx context.Context, now time.Time) (int, error) {
+	var claimed int
+
+	err := s.models.Transaction(ctx, func(tx data.Models) error {
+		due, err := tx.JobsSchedule.ClaimDue(now.Unix(), s.batchSize)
+		if err != nil {
+			return err
+		}
+		claimed = len(due)
+
+		for _, job := range due {
+			if err := s.dispatch(tx, job, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return claimed, err
+}
+
+// dispatch applies the job's misfire policy to its due runs, creates and enqueues
+// an execution for each run to fire, records the skipped ones and moves the
+// schedule row to the next fire time, or removes it when the job will not run again.
+func (s *Scheduler) dispatch(tx data.Models, job *data.DueJob, now time.Time) error {
+	sched, loc, err := loadSchedule(job.Schedule, job.Timezone)
+	if err != nil {
+		// submission validates schedules, so this only happens for rows written
+		// by hand. Drop the row rather than failing every tick on it.
+		s.logger.Error("Invalid schedule or timezone, job will not run again",
+			zap.Int64("job_id", job.JobID), zap.String("schedule", job.Schedule),
+			zap.String("timezone", job.Timezone), zap.Error(err))
+		return tx.JobsSchedule.Delete(job.ID)
+	}
+
+	first := time.Unix(job.NextExecution, 0).In(loc)
+	p := planRuns(sched, first, now, job.RunOnce, job.MisfirePolicy, job.MaxLateness)
+
+	if !p.droppedFirst.IsZero() {
+		// a single run stands for the runs beyond the limit
+		execution := &data.JobExecution{
+			JobID:         job.JobID,
+			ExecutionTime: p.droppedFirst.UTC(),
+			Status:        data.ExecutionSkippedMisfire,
+			Reason: fmt.Sprintf("missed runs from %s to %s dropped, over the limit of %d runs per dispatch",
+				p.droppedFirst.UTC().Format(time.RFC3339), p.droppedLast.UTC().Format(time.RFC3339), missedRunsLimit),
+		}
+		if err := tx.JobExecutions.Insert(execution); err != nil {
+			return err
+		}
+		s.logger.Warn("Too many missed runs, the oldest ones are recorded as a single skipped run",
+			zap.Int64("job_id", job.JobID), zap.Int64("execution_id", execution.ID),
+			zap.Time("dropped_from", p.droppedFirst), zap.Time("dropped_to", p.droppedLast))
+	}
+
+	for _, t := range p.skip {
+		execution := &data.JobExecution{
+			JobID:         job.JobID,
+			ExecutionTime: t.UTC(),
+			Status:        data.ExecutionSkippedMisfire,
+		}
+		if err := tx.JobExecutions.Insert(execution); err != nil {
+			return err
+		}
+	}
+	if len(p.skip) > 0 {
+		s.logger.Info("Missed runs skipped",
+			zap.Int64("job_id", job.JobID),
+			zap.String("misfire_policy", job.MisfirePolicy),
+			zap.Int("skipped", len(p.skip)))
+	}
+
+	for _, t := range p.fire {
+		if err := s.enqueue(tx, job, t, now); err != nil {
+			return err
+		}
+	}
+
+	if p.next.IsZero() {
+		if !job.RunOnce {
+			s.logger.Info("Schedule has no future execution", zap.Int64("job_id", job.JobID))
+		}
+		return tx.JobsSchedule.Delete(job.ID)
+	}
+
+	job.NextExecution = p.next.Unix()
+	return tx.JobsSchedule.Update(&job.JobSchedule)
+}
+
+// enqueue records a queued execution of the job for the given fire time and
+// pushes it to the job queue. If the job's concurrency policy forbids the run,
+// the execution is recorded as skipped instead.
+func (s *Scheduler) enqueue(tx data.Models, job *data.DueJob, executionTime, now time.Time) error {
+	admitted, reason, err := s.admit(tx, job, now)
+	if err != nil {
+		return err
+	}
+
+	execution := &data.JobExecution{
+		JobID:         job.JobID,
+		ExecutionTime: executionTime.UTC(),
+		Status:        data.ExecutionQueued,
+	}
+	if !admitted {
+		execution.Status = data.ExecutionSkipped
+		execution.Reason = reason
+	}
+	if err := tx.JobExecutions.Insert(execution); err != nil {
+		return err
+	}
+
+	if !admitted {
+		s.logger.Info("Run skipped",
+			zap.Int64("job_id", job.JobID),
+			zap.Int64("execution_id", execution.ID),
+			zap.String("reason", reason))
+		return nil
+	}
+
+	item := &data.QueueItem{ExecutionID: execution.ID, JobID: job.JobID, Priority: job.Priority}
+	if err := tx.Queue.Enqueue(item); err != nil {
+		return err
+	}
+
+	s.logger.Info("Job dispatched",
+		zap.Int64("job_id", job.JobID),
+		zap.Int64("execution_id", execution.ID),
+		zap.Int("priority", job.Priority),
+		zap.Time("execution_time", execution.ExecutionTime))
+	return nil
+}
+
+// NextExecution returns the first fire time of spec strictly after now, with
+// the expression evaluated on the wall clock of the timezone.
+func NextExecution(spec, timezone string, now time.Time) (time.Time, error) {
+	sched, loc, err := loadSchedule(spec, timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return sched.Next(now.In(loc)), nil
+}
+
+func loadSchedule(spec, timezone string) (*schedule.Schedule, *time.Location, error) {
+	sched, err := schedule.Parse(spec)
+	if err != nil {
+		return nil, nil, err
+	}
+	loc, err := schedule.LoadLocation(timezone)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sched, loc, nil
+}
@@ -0,0 +1,157 @@
+// Package source checks out the git repository of a job into the workspace of
+// its runs, with the git command of the host. The checkout is not isolated like
+// the steps: it runs on the executor host, outside of the job image, and the
+// steps see it only through the executors sharing the host workspace.
+package source
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"gertanoh.job-scheduler/internal/ymlparser"
+)
+
+// ErrLocalRepo is returned for a local repository outside of the directory
+// local repositories can be fetched from
+var ErrLocalRepo = errors.New("local repository not allowed")
+
+// Checkout fetches src into dir, an existing empty directory, and checks out
+// its ref, the default branch of the repository when empty. The submodules are
+// checked out as well when asked to, with the same depth. The output of git is
+// written to out. Checkout returns the SHA of the checked out commit.
+//
+// Local repositories, absolute paths or file:// URLs, are only fetched from
+// under localRoot, never when it is empty, so that a job cannot read the
+// repositories of the host, e.g. the workspaces of other jobs.
+//
+// Only the requested ref is fetched, a commit must be given by its full SHA.
+func Checkout(ctx context.Context, src ymlparser.Source, dir, localRoot string, out io.Writer) (string, error) {
+	repo, err := RepoURL(src.Repo, localRoot)
+	if err != nil {
+		return "", err
+	}
+	ref := src.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	fetch := []string{"fetch", "--quiet", "--no-tags"}
+	if src.Depth > 0 {
+		fetch = append(fetch, fmt.Sprintf("--depth=%d", src.Depth))
+	}
+	fetch = append(fetch, "origin", ref)
+
+	commands := [][]string{
+		{"init", "--quiet"},
+		{"remote", "add", "origin", repo},
+		fetch,
+		{"checkout", "--quiet", "--detach", "FETCH_HEAD"},
+	}
+	if src.Submodules {
+		update := []string{"submodule", "update", "--init", "--recursive"}
+		if src.Depth > 0 {
+			update = append(update, fmt.Sprintf("--depth=%d", src.Depth))
+		}
+		// git refuses local submodules by default, they are trusted along with a
+		// local repository, which was put under localRoot by the host
+		if strings.HasPrefix(repo, "file://") {
+			update = append([]string{"-c", "protocol.file.allow=always"}, update...)
+		}
+		commands = append(commands, update)
+	}
+
+	for _, args := range commands {
+		if err := git(ctx, dir, out, args...); err != nil {
+			return "", err
+		}
+	}
+
+	var sha bytes.Buffer
+	if err := git(ctx, dir, &sha, "rev-parse", "HEAD"); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(sha.String()), nil
+}
+
+// RepoURL returns the URL git fetches a repository from, local paths are
+// turned into file:// URLs so that shallow clones work for them too.
+// ErrLocalRepo is returned for the local repositories outside of localRoot.
+func RepoURL(repo, localRoot string) (string, error) {
+	path, local := strings.CutPrefix(repo, "file://")
+	if !local && !filepath.IsAbs(repo) {
+		return repo, nil
+	}
+
+	if err := checkLocal(path, localRoot); err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrLocalRepo, repo, err)
+	}
+	return "file://" + filepath.ToSlash(path), nil
+}
+
+// checkLocal checks that path is within root once their symbolic links are
+// resolved, so that a link cannot lead out of root
+func checkLocal(path, root string) error {
+	if root == "" {
+		return errors.New("local repositories are disabled")
+	}
+	if !filepath.IsAbs(path) {
+		return errors.New("not an absolute path")
+	}
+
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	path, err = filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("outside of %s", root)
+	}
+	return nil
+}
+
+// git runs a git command in dir. It never prompts for credentials.
+func git(ctx context.Context, dir string, out io.Writer, args ...string) error {
+	var stderr bytes.Buffer
+	c := exec.CommandContext(ctx, "git", args...)
+	c.Dir = dir
+	c.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=true")
+	c.Stdout = out
+	c.Stderr = io.MultiWriter(out, &stderr)
+
+	if err := c.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		msg := strings.TrimSpace(stderr.String())
+		var exitErr *exec.ExitError
+		if msg == "" || !errors.As(err, &exitErr) {
+			msg = err.Error()
+		}
+		return fmt.Errorf("git %s: %s", subcommand(args), msg)
+	}
+	return nil
+}
+
+// subcommand returns the git subcommand of args, skipping the -c options
+func subcommand(args []string) string {
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-c" {
+			i++
+			continue
+		}
+		return args[i]
+	}
+	return ""
+}
@@ -0,0 +1,216 @@
+package source_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "gertanoh.job-scheduler/internal/source"
+	"gertanoh.job-scheduler/internal/ymlparser"
+)
+
+// testRepo is a local repository with two commits on main, the first one tagged
+// v1, and a submodule added by the second one
+type testRepo struct {
+	dir           string
+	first, second string
+}
+
+func newTestRepo(t *testing.T) *testRepo {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+
+	base := t.TempDir()
+	sub := filepath.Join(base, "sub")
+	run(t, base, "init", "--quiet", "--initial-branch=main", sub)
+	writeFile(t, filepath.Join(sub, "lib.txt"), "lib\n")
+	run(t, sub, "add", ".")
+	run(t, sub, "commit", "--quiet", "-m", "lib")
+
+	repo := &testRepo{dir: filepath.Join(base, "repo")}
+	run(t, base, "init", "--quiet", "--initial-branch=main", repo.dir)
+	writeFile(t, filepath.Join(repo.dir, "version.txt"), "1\n")
+	run(t, repo.dir, "add", ".")
+	run(t, repo.dir, "commit", "--quiet", "-m", "first")
+	run(t, repo.dir, "tag", "v1")
+	repo.first = run(t, repo.dir, "rev-parse", "HEAD")
+
+	writeFile(t, filepath.Join(repo.dir, "version.txt"), "2\n")
+	run(t, repo.dir, "-c", "protocol.file.allow=always", "submodule", "--quiet", "add", "file://"+sub, "sub")
+	run(t, repo.dir, "commit", "--quiet", "-am", "second")
+	repo.second = run(t, repo.dir, "rev-parse", "HEAD")
+
+	return repo
+}
+
+func run(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckout(t *testing.T) {
+	repo := newTestRepo(t)
+
+	tests := []struct {
+		name        string
+		src         ymlparser.Source
+		wantSHA     string
+		wantVersion string
+		wantSub     bool
+		wantErr     bool
+	}{
+		{
+			name:        "Default branch",
+			src:         ymlparser.Source{Repo: repo.dir},
+			wantSHA:     repo.second,
+			wantVersion: "2\n",
+		},
+		{
+			name:        "Branch over file URL",
+			src:         ymlparser.Source{Repo: "file://" + repo.dir, Ref: "main", Depth: 1},
+			wantSHA:     repo.second,
+			wantVersion: "2\n",
+		},
+		{
+			name:        "Tag",
+			src:         ymlparser.Source{Repo: repo.dir, Ref: "v1"},
+			wantSHA:     repo.first,
+			wantVersion: "1\n",
+		},
+		{
+			name:        "Commit",
+			src:         ymlparser.Source{Repo: repo.dir, Ref: repo.first, Depth: 1},
+			wantSHA:     repo.first,
+			wantVersion: "1\n",
+		},
+		{
+			name:        "Submodules",
+			src:         ymlparser.Source{Repo: repo.dir, Submodules: true},
+			wantSHA:     repo.second,
+			wantVersion: "2\n",
+			wantSub:     true,
+		},
+		{
+			name:    "Unknown ref",
+			src:     ymlparser.Source{Repo: repo.dir, Ref: "no-such-branch"},
+			wantErr: true,
+		},
+		{
+			name:    "Unknown repository",
+			src:     ymlparser.Source{Repo: filepath.Join(filepath.Dir(repo.dir), "missing")},
+			wantErr: true,
+		},
+		{
+			name:    "Repository outside of the local root",
+			src:     ymlparser.Source{Repo: newTestRepo(t).dir},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			dir := t.TempDir()
+			var out bytes.Buffer
+			sha, err := Checkout(ctx, tt.src, dir, filepath.Dir(repo.dir), &out)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Checkout() expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Checkout() unexpected error: %v\n%s", err, out.String())
+			}
+
+			if sha != tt.wantSHA {
+				t.Errorf("Checkout() = %s, want %s", sha, tt.wantSHA)
+			}
+			version, err := os.ReadFile(filepath.Join(dir, "version.txt"))
+			if err != nil || string(version) != tt.wantVersion {
+				t.Errorf("version.txt = %q (%v), want %q", version, err, tt.wantVersion)
+			}
+			_, err = os.Stat(filepath.Join(dir, "sub", "lib.txt"))
+			if gotSub := err == nil; gotSub != tt.wantSub {
+				t.Errorf("submodule checked out = %v, want %v", gotSub, tt.wantSub)
+			}
+		})
+	}
+}
+
+func TestRepoURL(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	for _, dir := range []string{filepath.Join(root, "repo"), filepath.Join(outside, "repo")} {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(outside, "repo"), filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		repo    string
+		root    string
+		want    string
+		wantErr bool
+	}{
+		{name: "URL", repo: "https://example.com/org/repo.git", want: "https://example.com/org/repo.git"},
+		{name: "scp-like address", repo: "git@example.com:org/repo.git", want: "git@example.com:org/repo.git"},
+		{name: "Path", repo: filepath.Join(root, "repo"), root: root, want: "file://" + filepath.Join(root, "repo")},
+		{name: "File URL", repo: "file://" + filepath.Join(root, "repo"), root: root, want: "file://" + filepath.Join(root, "repo")},
+		{name: "Local repositories disabled", repo: filepath.Join(root, "repo"), wantErr: true},
+		{name: "Path outside of the root", repo: filepath.Join(outside, "repo"), root: root, wantErr: true},
+		{name: "File URL outside of the root", repo: "file://" + filepath.Join(outside, "repo"), root: root, wantErr: true},
+		{name: "Parent directory", repo: root + "/../" + filepath.Base(outside) + "/repo", root: root, wantErr: true},
+		{name: "Link out of the root", repo: filepath.Join(root, "link"), root: root, wantErr: true},
+		{name: "Relative file URL", repo: "file://repo", root: root, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RepoURL(tt.repo, tt.root)
+			if tt.wantErr {
+				if !errors.Is(err, ErrLocalRepo) {
+					t.Fatalf("RepoURL() error = %v, want %v", err, ErrLocalRepo)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RepoURL() unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("RepoURL() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
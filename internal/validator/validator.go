@@ -0,0 +1,40 @@
+package validator
+
+// Validator collects validation errors, keyed by the name of the invalid field.
+type Validator struct {
+	Errors map[string]string
+}
+
+// New validator instance creator
+func New() *Validator {
+	return &Validator{Errors: make(map[string]string)}
+}
+
+// Valid returns true if no error was recorded
+func (v *Validator) Valid() bool {
+	return len(v.Errors) == 0
+}
+
+// AddError records an error message for a key, unless the key already has one
+func (v *Validator) AddError(key, message string) {
+	if _, exists := v.Errors[key]; !exists {
+		v.Errors[key] = message
+	}
+}
+
+// Check records an error message for a key if ok is false
+func (v *Validator) Check(ok bool, key, message string) {
+	if !ok {
+		v.AddError(key, message)
+	}
+}
+
+// PermittedValue returns true if value is one of the permitted values
+func PermittedValue[T comparable](value T, permittedValues ...T) bool {
+	for i := range permittedValues {
+		if value == permittedValues[i] {
+			return true
+		}
+	}
+	return false
+}
@@ -1,23 +1,289 @@
 package ymlparser
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"gertanoh.job-scheduler/internal/schedule"
+	"github.com/docker/go-units"
 	"gopkg.in/yaml.v3"
 )
 
-// Job represents a scheduled job.
+// Misfire policies, applied to the runs missed while the scheduler was down.
+const (
+	// MisfireFireAll dispatches every missed run.
+	MisfireFireAll = "fire_all"
+	// MisfireFireOnce dispatches a single run now in place of all the missed ones.
+	MisfireFireOnce = "fire_once"
+	// MisfireSkip drops the missed runs and waits for the next fire time.
+	MisfireSkip = "skip"
+)
+
+// Concurrency policies, deciding what happens when a run is due while a
+// previous run of the same job is still queued or running.
+const (
+	// ConcurrencyAllow lets runs overlap.
+	ConcurrencyAllow = "Allow"
+	// ConcurrencyForbid skips the new run.
+	ConcurrencyForbid = "Forbid"
+	// ConcurrencyReplace cancels the previous run and starts the new one.
+	ConcurrencyReplace = "Replace"
+)
+
+// Job priorities, higher priority jobs are dispatched and executed first.
+const (
+	MinPriority     = 1
+	MaxPriority     = 9
+	DefaultPriority = 5
+)
+
+// DefaultMaxLateness is how late a run can be dispatched before it counts as missed.
+const DefaultMaxLateness = Duration(time.Minute)
+
+// Duration is a time.Duration written in YAML like time.ParseDuration reads it,
+// e.g. 90s, 1h30m or 0
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.ScalarNode {
+		return fmt.Errorf("invalid duration on line %d", value.Line)
+	}
+	duration, err := time.ParseDuration(value.Value)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", value.Value)
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Failure kinds a retry policy can retry.
+const (
+	// RetryOnFailed is a step exiting with a non-zero status.
+	RetryOnFailed = "failed"
+	// RetryOnTimedOut is a run or a step reaching its timeout.
+	RetryOnTimedOut = "timed_out"
+	// RetryOnError is a run the executor failed to carry out, e.g. a source
+	// that could not be fetched, a step that could not be started or an
+	// executor shut down during the run.
+	RetryOnError = "error"
+)
+
+// Retry policy defaults and bounds.
+const (
+	MaxRetryAttempts         = 10
+	DefaultRetryInitialDelay = Duration(10 * time.Second)
+	DefaultRetryMultiplier   = 2.0
+	DefaultRetryMaxDelay     = Duration(10 * time.Minute)
+)
+
+// Retry is the retry policy of a job. A failed run is attempted again up to
+// MaxAttempts times in total, the first retry waits InitialDelay and every
+// following one Multiplier times longer, at most MaxDelay. Only the failure
+// kinds listed in RetryOn are retried.
+type Retry struct {
+	MaxAttempts  int      `json:"max_attempts" yaml:"max_attempts"`
+	InitialDelay Duration `json:"initial_delay" yaml:"initial_delay"`
+	Multiplier   float64  `json:"multiplier" yaml:"multiplier"`
+	MaxDelay     Duration `json:"max_delay" yaml:"max_delay"`
+	RetryOn      []string `json:"retry_on" yaml:"retry_on"`
+}
+
+// Retries reports whether a run failing with the given kind on the given
+// attempt, counted from 1, is attempted again.
+func (r *Retry) Retries(kind string, attempt int) bool {
+	return r != nil && attempt < r.MaxAttempts && slices.Contains(r.RetryOn, kind)
+}
+
+// Backoff returns how long to wait before retrying the given failed attempt, counted from 1.
+func (r *Retry) Backoff(attempt int) time.Duration {
+	delay := float64(r.InitialDelay) * math.Pow(r.Multiplier, float64(attempt-1))
+	if delay > float64(r.MaxDelay) {
+		return time.Duration(r.MaxDelay)
+	}
+	return time.Duration(delay)
+}
+
+// MinMemory is the lowest memory limit a job can ask for, the one of Docker
+const MinMemory = 6 * 1024 * 1024
+
+// ByteSize is a size in bytes, written in YAML as a number of bytes or with a
+// unit: 512m, 2g, 1GiB. Units are powers of 1024.
+type ByteSize int64
+
+func (b *ByteSize) UnmarshalYAML(value *yaml.Node) error {
+	return b.Set(value.Value)
+}
+
+// Set parses a size, so that a ByteSize can be used as a flag.Value
+func (b *ByteSize) Set(s string) error {
+	size, err := units.RAMInBytes(s)
+	if err != nil {
+		return fmt.Errorf("invalid size %q", s)
+	}
+	*b = ByteSize(size)
+	return nil
+}
+
+func (b ByteSize) String() string {
+	return units.BytesSize(float64(b))
+}
+
+// Resources are the limits applied to every step of a job, zero values are unlimited.
+type Resources struct {
+	// CPUs is the number of CPUs, e.g. 1.5
+	CPUs float64 `json:"cpus,omitempty" yaml:"cpus"`
+	// Memory above which a step is killed
+	Memory ByteSize `json:"memory,omitempty" yaml:"memory"`
+	// PIDs limits the number of processes and threads
+	PIDs int64 `json:"pids,omitempty" yaml:"pids"`
+	// TmpfsSize is the size of /tmp, a tmpfs
+	TmpfsSize ByteSize `json:"tmpfs_size,omitempty" yaml:"tmpfs_size"`
+}
+
+// ApplyLimits checks the resources against the maximum allowed by the cluster
+// and sets the ones left unlimited to that maximum. Zero values of limits are unbounded.
+func (r *Resources) ApplyLimits(limits Resources) error {
+	if limits.CPUs > 0 && r.CPUs > limits.CPUs {
+		return fmt.Errorf("cpus %g exceeds the maximum of %g", r.CPUs, limits.CPUs)
+	}
+	if limits.Memory > 0 && r.Memory > limits.Memory {
+		return fmt.Errorf("memory %s exceeds the maximum of %s", r.Memory, limits.Memory)
+	}
+	if limits.PIDs > 0 && r.PIDs > limits.PIDs {
+		return fmt.Errorf("pids %d exceeds the maximum of %d", r.PIDs, limits.PIDs)
+	}
+	if limits.TmpfsSize > 0 && r.TmpfsSize > limits.TmpfsSize {
+		return fmt.Errorf("tmpfs_size %s exceeds the maximum of %s", r.TmpfsSize, limits.TmpfsSize)
+	}
+
+	if r.CPUs == 0 {
+		r.CPUs = limits.CPUs
+	}
+	if r.Memory == 0 {
+		r.Memory = limits.Memory
+	}
+	if r.PIDs == 0 {
+		r.PIDs = limits.PIDs
+	}
+	if r.TmpfsSize == 0 {
+		r.TmpfsSize = limits.TmpfsSize
+	}
+	return nil
+}
+
+func (r *Resources) validate() error {
+	if r.CPUs < 0 {
+		return fmt.Errorf("cpus %g must be positive", r.CPUs)
+	}
+	if r.Memory != 0 && r.Memory < MinMemory {
+		return fmt.Errorf("memory %s must be at least %s", r.Memory, ByteSize(MinMemory))
+	}
+	if r.PIDs < 0 {
+		return fmt.Errorf("pids %d must be positive", r.PIDs)
+	}
+	return nil
+}
+
+// repoSchemes are the URL schemes a source repository can be fetched with
+var repoSchemes = []string{"https://", "http://", "ssh://", "git://", "file://"}
+
+// Source is the git repository checked out in the workspace of a job before
+// its first step. Repo is a URL, an scp-like address (git@host:path) or an
+// absolute local path. Ref is a branch, a tag or a full commit SHA, the default
+// branch when empty. Depth makes a shallow checkout, the full history when zero.
+type Source struct {
+	Repo       string `json:"repo" yaml:"repo"`
+	Ref        string `json:"ref,omitempty" yaml:"ref"`
+	Submodules bool   `json:"submodules,omitempty" yaml:"submodules"`
+	Depth      int    `json:"depth,omitempty" yaml:"depth"`
+}
+
+func (s *Source) validate() error {
+	switch {
+	case s.Repo == "":
+		return errors.New("repo must not be empty")
+	case strings.HasPrefix(s.Repo, "-"), strings.ContainsAny(s.Repo, " \t\n"):
+		return fmt.Errorf("invalid repo %q", s.Repo)
+	case !strings.HasPrefix(s.Repo, "/") && !hasRepoScheme(s.Repo) && !scpLike(s.Repo):
+		return fmt.Errorf("invalid repo %q, must be a URL (%s), user@host:path or an absolute path",
+			s.Repo, strings.Join(repoSchemes, ", "))
+	}
+	if strings.HasPrefix(s.Ref, "-") || strings.ContainsAny(s.Ref, " \t\n") {
+		return fmt.Errorf("invalid ref %q", s.Ref)
+	}
+	if s.Depth < 0 {
+		return fmt.Errorf("invalid depth %d, must be positive", s.Depth)
+	}
+	return nil
+}
+
+func hasRepoScheme(repo string) bool {
+	for _, scheme := range repoSchemes {
+		if strings.HasPrefix(repo, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// scpLike reports whether repo is written as user@host:path
+func scpLike(repo string) bool {
+	at := strings.Index(repo, "@")
+	colon := strings.Index(repo, ":")
+	return at > 0 && colon > at+1 && !strings.Contains(repo[:colon], "/")
+}
+
+// Step is a command run as part of a job.
+// Image, Env and Timeout are optional and override the executor defaults.
+// Steps stop at the first failure unless it continues on error, steps marked
+// always run anyway, e.g. to clean up.
 type Step struct {
-	Name string `json:"name" yaml:"name"`
-	Run  string `json:"run" yaml:"run"`
+	Name            string            `json:"name" yaml:"name"`
+	Run             string            `json:"run" yaml:"run"`
+	Image           string            `json:"image,omitempty" yaml:"image"`
+	Env             map[string]string `json:"env,omitempty" yaml:"env"`
+	Timeout         Duration          `json:"timeout,omitempty" yaml:"timeout"`
+	ContinueOnError bool              `json:"continue_on_error,omitempty" yaml:"continue_on_error"`
+	Always          bool              `json:"always,omitempty" yaml:"always"`
 }
 
+// Job represents a scheduled job.
 type Job struct {
-	Name     string `json:"name" yaml:"name"`
-	Schedule string `json:"schedule" yaml:"schedule"`
-	RunOnce  bool   `json:"run_once" yaml:"run_once"`
-	Steps    []Step `json:"steps" yaml:"steps"`
+	Name          string `json:"name" yaml:"name"`
+	Schedule      string `json:"schedule" yaml:"schedule"`
+	Timezone      string `json:"timezone" yaml:"timezone"`
+	RunOnce       bool   `json:"run_once" yaml:"run_once"`
+	MisfirePolicy string `json:"misfire_policy" yaml:"misfire_policy"`
+	// MaxLateness is nil when omitted, DefaultMaxLateness is used. Zero counts
+	// any late run as missed.
+	MaxLateness       *Duration `json:"max_lateness" yaml:"max_lateness"`
+	ConcurrencyPolicy string    `json:"concurrency_policy" yaml:"concurrency_policy"`
+	Priority          int       `json:"priority" yaml:"priority"`
+	// Timeout bounds a whole run of the job, no limit when zero
+	Timeout Duration `json:"timeout,omitempty" yaml:"timeout"`
+	// Retry is nil for jobs whose failed runs are not retried
+	Retry *Retry `json:"retry,omitempty" yaml:"retry"`
+	// Resources is nil for jobs without limits
+	Resources *Resources `json:"resources,omitempty" yaml:"resources"`
+	// Source is nil for jobs starting from an empty workspace
+	Source *Source `json:"source,omitempty" yaml:"source"`
+	// Artifacts are glob patterns of the workspace files kept once the steps are
+	// done, relative to the workspace. A ** segment matches any number of directories.
+	Artifacts []string `json:"artifacts,omitempty" yaml:"artifacts"`
+	Steps     []Step   `json:"steps" yaml:"steps"`
 }
 
 // ParseYAMLFile parses a YAML file and returns a slice of Job structs.
+// Jobs are validated and optional fields are set to their default value.
 func ParseYAML(yamlData []byte) ([]Job, error) {
 
 	// Define a struct to match the structure of the YAML data
@@ -30,5 +296,181 @@ func ParseYAML(yamlData []byte) ([]Job, error) {
 		return nil, err
 	}
 
+	for i := range yamlStruct.Jobs {
+		job := &yamlStruct.Jobs[i]
+		if err := job.validate(); err != nil {
+			return nil, fmt.Errorf("job %q: %w", job.Name, err)
+		}
+		job.setDefaults()
+	}
+
 	return yamlStruct.Jobs, nil
 }
+
+// validate rejects jobs with an invalid cron expression, an unknown
+// timezone, an unknown misfire or concurrency policy, an out of range priority,
+// an invalid retry policy, invalid resources, an invalid source, an invalid
+// artifact pattern or an invalid step.
+func (j *Job) validate() error {
+	if _, err := schedule.Parse(j.Schedule); err != nil {
+		return fmt.Errorf("invalid schedule: %w", err)
+	}
+	if _, err := schedule.LoadLocation(j.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone: %w", err)
+	}
+
+	switch j.MisfirePolicy {
+	case "", MisfireFireAll, MisfireFireOnce, MisfireSkip:
+	default:
+		return fmt.Errorf("invalid misfire_policy %q, must be one of %s, %s or %s",
+			j.MisfirePolicy, MisfireFireAll, MisfireFireOnce, MisfireSkip)
+	}
+	if j.MaxLateness != nil && *j.MaxLateness < 0 {
+		return fmt.Errorf("invalid max_lateness %s, must be positive", *j.MaxLateness)
+	}
+
+	switch j.ConcurrencyPolicy {
+	case "", ConcurrencyAllow, ConcurrencyForbid, ConcurrencyReplace:
+	default:
+		return fmt.Errorf("invalid concurrency_policy %q, must be one of %s, %s or %s",
+			j.ConcurrencyPolicy, ConcurrencyAllow, ConcurrencyForbid, ConcurrencyReplace)
+	}
+
+	if j.Timeout < 0 {
+		return fmt.Errorf("invalid timeout %s, must be positive", j.Timeout)
+	}
+
+	if j.Retry != nil {
+		if err := j.Retry.validate(); err != nil {
+			return fmt.Errorf("invalid retry: %w", err)
+		}
+	}
+
+	if j.Resources != nil {
+		if err := j.Resources.validate(); err != nil {
+			return fmt.Errorf("invalid resources: %w", err)
+		}
+	}
+
+	if j.Source != nil {
+		if err := j.Source.validate(); err != nil {
+			return fmt.Errorf("invalid source: %w", err)
+		}
+	}
+
+	for _, pattern := range j.Artifacts {
+		if err := validateArtifactPattern(pattern); err != nil {
+			return err
+		}
+	}
+
+	if len(j.Steps) == 0 {
+		return errors.New("a job needs at least one step")
+	}
+	for i, step := range j.Steps {
+		if err := step.validate(); err != nil {
+			return fmt.Errorf("step %d %q: %w", i+1, step.Name, err)
+		}
+	}
+
+	// 0 is the zero value of an omitted priority
+	if j.Priority != 0 && (j.Priority < MinPriority || j.Priority > MaxPriority) {
+		return fmt.Errorf("invalid priority %d, must be between %d and %d", j.Priority, MinPriority, MaxPriority)
+	}
+
+	return nil
+}
+
+func (j *Job) setDefaults() {
+	if j.Timezone == "" {
+		j.Timezone = "UTC"
+	}
+	if j.MisfirePolicy == "" {
+		j.MisfirePolicy = MisfireFireOnce
+	}
+	if j.MaxLateness == nil {
+		maxLateness := DefaultMaxLateness
+		j.MaxLateness = &maxLateness
+	}
+	if j.ConcurrencyPolicy == "" {
+		j.ConcurrencyPolicy = ConcurrencyAllow
+	}
+	if j.Priority == 0 {
+		j.Priority = DefaultPriority
+	}
+	if j.Retry != nil {
+		j.Retry.setDefaults()
+	}
+}
+
+// validate checks the retry policy, zero values stand for the defaults
+func (r *Retry) validate() error {
+	if r.MaxAttempts < 1 || r.MaxAttempts > MaxRetryAttempts {
+		return fmt.Errorf("max_attempts %d must be between 1 and %d", r.MaxAttempts, MaxRetryAttempts)
+	}
+	if r.InitialDelay < 0 {
+		return fmt.Errorf("initial_delay %s must be positive", r.InitialDelay)
+	}
+	if r.Multiplier != 0 && r.Multiplier < 1 {
+		return fmt.Errorf("multiplier %g must be at least 1", r.Multiplier)
+	}
+	if r.MaxDelay < 0 || (r.MaxDelay > 0 && r.MaxDelay < r.InitialDelay) {
+		return fmt.Errorf("max_delay %s must be at least initial_delay", r.MaxDelay)
+	}
+	for _, kind := range r.RetryOn {
+		switch kind {
+		case RetryOnFailed, RetryOnTimedOut, RetryOnError:
+		default:
+			return fmt.Errorf("unknown failure kind %q in retry_on, must be one of %s, %s or %s",
+				kind, RetryOnFailed, RetryOnTimedOut, RetryOnError)
+		}
+	}
+	return nil
+}
+
+func (r *Retry) setDefaults() {
+	if r.InitialDelay == 0 {
+		r.InitialDelay = DefaultRetryInitialDelay
+	}
+	if r.Multiplier == 0 {
+		r.Multiplier = DefaultRetryMultiplier
+	}
+	if r.MaxDelay == 0 {
+		r.MaxDelay = max(DefaultRetryMaxDelay, r.InitialDelay)
+	}
+	if len(r.RetryOn) == 0 {
+		r.RetryOn = []string{RetryOnFailed, RetryOnTimedOut, RetryOnError}
+	}
+}
+
+// validateArtifactPattern rejects the patterns that are malformed or could
+// match files outside of the workspace
+func validateArtifactPattern(pattern string) error {
+	if pattern == "" || path.IsAbs(pattern) {
+		return fmt.Errorf("invalid artifact pattern %q, must be relative to the workspace", pattern)
+	}
+	for _, segment := range strings.Split(pattern, "/") {
+		if segment == ".." {
+			return fmt.Errorf("invalid artifact pattern %q, must not leave the workspace", pattern)
+		}
+		if _, err := path.Match(segment, ""); err != nil {
+			return fmt.Errorf("invalid artifact pattern %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+func (s *Step) validate() error {
+	if strings.TrimSpace(s.Run) == "" {
+		return errors.New("run must not be empty")
+	}
+	if s.Timeout < 0 {
+		return fmt.Errorf("invalid timeout %s, must be positive", s.Timeout)
+	}
+	for name := range s.Env {
+		if name == "" || strings.ContainsAny(name, "= \t\n") {
+			return fmt.Errorf("invalid environment variable name %q", name)
+		}
+	}
+	return nil
+}
@@ -1,7 +1,9 @@
 package ymlparser_test
 
 import (
+	"reflect"
 	"testing"
+	"time"
 
 	. "gertanoh.job-scheduler/internal/ymlparser"
 )
@@ -16,31 +18,489 @@ func TestParseYAML(t *testing.T) {
 		{
 			name: "Valid YAML",
 			yamlData: []byte(`
-- name: Every30SecondsJob
-  schedule: "*/30 * * * * *"
-  run_once: false
-  steps:
-    - name: YourStep
-      run: your_command_here
+jobs:
+  - name: Every30SecondsJob
+    schedule: "*/30 * * * * *"
+    timezone: Europe/Paris
+    run_once: false
+    misfire_policy: skip
+    max_lateness: 10m
+    concurrency_policy: Forbid
+    priority: 8
+    timeout: 1h
+    steps:
+      - name: YourStep
+        run: your_command_here
+        image: golang:1.22
+        env:
+          GOFLAGS: -mod=mod
+        timeout: 5m
+        continue_on_error: true
+      - name: Cleanup
+        run: rm -rf build
+        always: true
 `),
 			expected: []Job{
 				{
-					Name:     "Every30SecondsJob",
-					Schedule: "*/30 * * * * *",
-					RunOnce:  false,
-					Steps: []struct {
-						Name string `yaml:"name"`
-						Run  string `yaml:"run"`
-					}{
+					Name:              "Every30SecondsJob",
+					Schedule:          "*/30 * * * * *",
+					Timezone:          "Europe/Paris",
+					RunOnce:           false,
+					MisfirePolicy:     MisfireSkip,
+					MaxLateness:       duration(Duration(10 * time.Minute)),
+					ConcurrencyPolicy: ConcurrencyForbid,
+					Priority:          8,
+					Timeout:           Duration(time.Hour),
+					Steps: []Step{
 						{
-							Name: "YourStep",
-							Run:  "your_command_here",
+							Name:            "YourStep",
+							Run:             "your_command_here",
+							Image:           "golang:1.22",
+							Env:             map[string]string{"GOFLAGS": "-mod=mod"},
+							Timeout:         Duration(5 * time.Minute),
+							ContinueOnError: true,
 						},
+						{
+							Name:   "Cleanup",
+							Run:    "rm -rf build",
+							Always: true,
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Invalid schedule",
+			yamlData: []byte(`
+jobs:
+  - name: BadSchedule
+    schedule: "every day"
+    steps:
+      - name: YourStep
+        run: your_command_here
+`),
+			expected: nil,
+			wantErr:  true,
+		},
+		{
+			name: "Invalid timezone",
+			yamlData: []byte(`
+jobs:
+  - name: BadTimezone
+    schedule: "0 0 * * *"
+    timezone: Mars/Olympus_Mons
+    steps:
+      - name: YourStep
+        run: your_command_here
+`),
+			expected: nil,
+			wantErr:  true,
+		},
+		{
+			name: "Defaults",
+			yamlData: []byte(`
+jobs:
+  - name: Nightly
+    schedule: "@daily"
+    steps:
+      - name: YourStep
+        run: your_command_here
+`),
+			expected: []Job{
+				{
+					Name:              "Nightly",
+					Schedule:          "@daily",
+					Timezone:          "UTC",
+					MisfirePolicy:     MisfireFireOnce,
+					MaxLateness:       duration(DefaultMaxLateness),
+					ConcurrencyPolicy: ConcurrencyAllow,
+					Priority:          DefaultPriority,
+					Steps:             []Step{{Name: "YourStep", Run: "your_command_here"}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Zero durations",
+			yamlData: []byte(`
+jobs:
+  - name: Strict
+    schedule: "@daily"
+    max_lateness: 0
+    timeout: 0
+    retry:
+      max_attempts: 2
+      initial_delay: 0
+      max_delay: 0
+    steps:
+      - name: YourStep
+        run: your_command_here
+        timeout: 0
+`),
+			expected: []Job{
+				{
+					Name:              "Strict",
+					Schedule:          "@daily",
+					Timezone:          "UTC",
+					MisfirePolicy:     MisfireFireOnce,
+					MaxLateness:       duration(0),
+					ConcurrencyPolicy: ConcurrencyAllow,
+					Priority:          DefaultPriority,
+					Retry: &Retry{
+						MaxAttempts:  2,
+						InitialDelay: DefaultRetryInitialDelay,
+						Multiplier:   DefaultRetryMultiplier,
+						MaxDelay:     DefaultRetryMaxDelay,
+						RetryOn:      []string{RetryOnFailed, RetryOnTimedOut, RetryOnError},
+					},
+					Steps: []Step{{Name: "YourStep", Run: "your_command_here"}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Duration without a unit",
+			yamlData: []byte(`
+jobs:
+  - name: Impatient
+    schedule: "@daily"
+    steps:
+      - name: YourStep
+        run: your_command_here
+        timeout: 30
+`),
+			expected: nil,
+			wantErr:  true,
+		},
+		{
+			name: "Invalid misfire policy",
+			yamlData: []byte(`
+jobs:
+  - name: BadPolicy
+    schedule: "0 0 * * *"
+    misfire_policy: sometimes
+    steps:
+      - name: YourStep
+        run: your_command_here
+`),
+			expected: nil,
+			wantErr:  true,
+		},
+		{
+			name: "Invalid concurrency policy",
+			yamlData: []byte(`
+jobs:
+  - name: BadPolicy
+    schedule: "0 0 * * *"
+    concurrency_policy: forbid
+    steps:
+      - name: YourStep
+        run: your_command_here
+`),
+			expected: nil,
+			wantErr:  true,
+		},
+		{
+			name: "Priority out of range",
+			yamlData: []byte(`
+jobs:
+  - name: TooImportant
+    schedule: "0 0 * * *"
+    priority: 42
+    steps:
+      - name: YourStep
+        run: your_command_here
+`),
+			expected: nil,
+			wantErr:  true,
+		},
+		{
+			name: "Negative timeout",
+			yamlData: []byte(`
+jobs:
+  - name: Impatient
+    schedule: "0 0 * * *"
+    timeout: -5m
+    steps:
+      - name: YourStep
+        run: your_command_here
+`),
+			expected: nil,
+			wantErr:  true,
+		},
+		{
+			name: "Retry policy",
+			yamlData: []byte(`
+jobs:
+  - name: Flaky
+    schedule: "0 0 * * *"
+    retry:
+      max_attempts: 3
+      initial_delay: 30s
+      retry_on: [failed]
+    steps:
+      - name: YourStep
+        run: go mod download
+`),
+			expected: []Job{
+				{
+					Name:              "Flaky",
+					Schedule:          "0 0 * * *",
+					Timezone:          "UTC",
+					MisfirePolicy:     MisfireFireOnce,
+					MaxLateness:       duration(DefaultMaxLateness),
+					ConcurrencyPolicy: ConcurrencyAllow,
+					Priority:          DefaultPriority,
+					Retry: &Retry{
+						MaxAttempts:  3,
+						InitialDelay: Duration(30 * time.Second),
+						Multiplier:   DefaultRetryMultiplier,
+						MaxDelay:     DefaultRetryMaxDelay,
+						RetryOn:      []string{RetryOnFailed},
 					},
+					Steps: []Step{{Name: "YourStep", Run: "go mod download"}},
 				},
 			},
 			wantErr: false,
 		},
+		{
+			name: "Retry without max attempts",
+			yamlData: []byte(`
+jobs:
+  - name: Flaky
+    schedule: "0 0 * * *"
+    retry:
+      initial_delay: 30s
+    steps:
+      - name: YourStep
+        run: your_command_here
+`),
+			expected: nil,
+			wantErr:  true,
+		},
+		{
+			name: "Retry max delay below initial delay",
+			yamlData: []byte(`
+jobs:
+  - name: Flaky
+    schedule: "0 0 * * *"
+    retry:
+      max_attempts: 3
+      initial_delay: 1m
+      max_delay: 10s
+    steps:
+      - name: YourStep
+        run: your_command_here
+`),
+			expected: nil,
+			wantErr:  true,
+		},
+		{
+			name: "Unknown retry failure kind",
+			yamlData: []byte(`
+jobs:
+  - name: Flaky
+    schedule: "0 0 * * *"
+    retry:
+      max_attempts: 3
+      retry_on: [cancelled]
+    steps:
+      - name: YourStep
+        run: your_command_here
+`),
+			expected: nil,
+			wantErr:  true,
+		},
+		{
+			name: "Resources",
+			yamlData: []byte(`
+jobs:
+  - name: Bounded
+    schedule: "0 0 * * *"
+    resources:
+      cpus: 1.5
+      memory: 512m
+      pids: 256
+      tmpfs_size: 1GiB
+    steps:
+      - name: YourStep
+        run: go test ./...
+`),
+			expected: []Job{
+				{
+					Name:              "Bounded",
+					Schedule:          "0 0 * * *",
+					Timezone:          "UTC",
+					MisfirePolicy:     MisfireFireOnce,
+					MaxLateness:       duration(DefaultMaxLateness),
+					ConcurrencyPolicy: ConcurrencyAllow,
+					Priority:          DefaultPriority,
+					Resources: &Resources{
+						CPUs:      1.5,
+						Memory:    512 << 20,
+						PIDs:      256,
+						TmpfsSize: 1 << 30,
+					},
+					Steps: []Step{{Name: "YourStep", Run: "go test ./..."}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Invalid memory size",
+			yamlData: []byte(`
+jobs:
+  - name: Bounded
+    schedule: "0 0 * * *"
+    resources:
+      memory: lots
+    steps:
+      - name: YourStep
+        run: your_command_here
+`),
+			expected: nil,
+			wantErr:  true,
+		},
+		{
+			name: "Memory below the minimum",
+			yamlData: []byte(`
+jobs:
+  - name: Bounded
+    schedule: "0 0 * * *"
+    resources:
+      memory: 1k
+    steps:
+      - name: YourStep
+        run: your_command_here
+`),
+			expected: nil,
+			wantErr:  true,
+		},
+		{
+			name: "Source",
+			yamlData: []byte(`
+jobs:
+  - name: Build
+    schedule: "0 0 * * *"
+    source:
+      repo: https://github.com/gertanoh/job-scheduler.git
+      ref: main
+      submodules: true
+      depth: 1
+    artifacts:
+      - bin/*
+      - "**/report.xml"
+    steps:
+      - name: YourStep
+        run: go build ./...
+`),
+			expected: []Job{
+				{
+					Name:              "Build",
+					Schedule:          "0 0 * * *",
+					Timezone:          "UTC",
+					MisfirePolicy:     MisfireFireOnce,
+					MaxLateness:       duration(DefaultMaxLateness),
+					ConcurrencyPolicy: ConcurrencyAllow,
+					Priority:          DefaultPriority,
+					Source: &Source{
+						Repo:       "https://github.com/gertanoh/job-scheduler.git",
+						Ref:        "main",
+						Submodules: true,
+						Depth:      1,
+					},
+					Artifacts: []string{"bin/*", "**/report.xml"},
+					Steps:     []Step{{Name: "YourStep", Run: "go build ./..."}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Source with a relative path",
+			yamlData: []byte(`
+jobs:
+  - name: Build
+    schedule: "0 0 * * *"
+    source:
+      repo: ../job-scheduler
+    steps:
+      - name: YourStep
+        run: go build ./...
+`),
+			expected: nil,
+			wantErr:  true,
+		},
+		{
+			name: "Source ref looking like an option",
+			yamlData: []byte(`
+jobs:
+  - name: Build
+    schedule: "0 0 * * *"
+    source:
+      repo: git@github.com:gertanoh/job-scheduler.git
+      ref: --upload-pack=touch
+    steps:
+      - name: YourStep
+        run: go build ./...
+`),
+			expected: nil,
+			wantErr:  true,
+		},
+		{
+			name: "Artifact pattern outside of the workspace",
+			yamlData: []byte(`
+jobs:
+  - name: Build
+    schedule: "0 0 * * *"
+    artifacts:
+      - bin/*
+      - ../secrets
+    steps:
+      - name: YourStep
+        run: go build -o bin/ ./...
+`),
+			expected: nil,
+			wantErr:  true,
+		},
+		{
+			name: "Malformed artifact pattern",
+			yamlData: []byte(`
+jobs:
+  - name: Build
+    schedule: "0 0 * * *"
+    artifacts:
+      - "bin/[a-"
+    steps:
+      - name: YourStep
+        run: go build -o bin/ ./...
+`),
+			expected: nil,
+			wantErr:  true,
+		},
+		{
+			name: "No steps",
+			yamlData: []byte(`
+jobs:
+  - name: NothingToDo
+    schedule: "0 0 * * *"
+`),
+			expected: nil,
+			wantErr:  true,
+		},
+		{
+			name: "Empty step command",
+			yamlData: []byte(`
+jobs:
+  - name: EmptyStep
+    schedule: "0 0 * * *"
+    steps:
+      - name: YourStep
+        run: " "
+`),
+			expected: nil,
+			wantErr:  true,
+		},
 		{
 			name:     "Invalid YAML",
 			yamlData: []byte("invalid: -yaml: data"),
@@ -67,14 +527,23 @@ func TestParseYAML(t *testing.T) {
 				for i := range got {
 					if got[i].Name != tt.expected[i].Name ||
 						got[i].Schedule != tt.expected[i].Schedule ||
+						got[i].Timezone != tt.expected[i].Timezone ||
+						got[i].MisfirePolicy != tt.expected[i].MisfirePolicy ||
+						!reflect.DeepEqual(got[i].MaxLateness, tt.expected[i].MaxLateness) ||
+						got[i].ConcurrencyPolicy != tt.expected[i].ConcurrencyPolicy ||
+						got[i].Priority != tt.expected[i].Priority ||
 						got[i].RunOnce != tt.expected[i].RunOnce ||
+						got[i].Timeout != tt.expected[i].Timeout ||
+						!reflect.DeepEqual(got[i].Retry, tt.expected[i].Retry) ||
+						!reflect.DeepEqual(got[i].Resources, tt.expected[i].Resources) ||
+						!reflect.DeepEqual(got[i].Source, tt.expected[i].Source) ||
+						!reflect.DeepEqual(got[i].Artifacts, tt.expected[i].Artifacts) ||
 						len(got[i].Steps) != len(tt.expected[i].Steps) {
 						t.Errorf("ParseYAML() got = %v, want %v", got, tt.expected)
 						return
 					}
 					for j := range got[i].Steps {
-						if got[i].Steps[j].Name != tt.expected[i].Steps[j].Name ||
-							got[i].Steps[j].Run != tt.expected[i].Steps[j].Run {
+						if !reflect.DeepEqual(got[i].Steps[j], tt.expected[i].Steps[j]) {
 							t.Errorf("ParseYAML() got = %v, want %v", got, tt.expected)
 							return
 						}
@@ -84,3 +553,93 @@ func TestParseYAML(t *testing.T) {
 		})
 	}
 }
+
+// duration returns a pointer to d, for the optional durations
+func duration(d Duration) *Duration {
+	return &d
+}
+
+func TestRetry(t *testing.T) {
+	retry := &Retry{
+		MaxAttempts:  4,
+		InitialDelay: Duration(10 * time.Second),
+		Multiplier:   3,
+		MaxDelay:     Duration(time.Minute),
+		RetryOn:      []string{RetryOnFailed, RetryOnError},
+	}
+
+	tests := []struct {
+		name        string
+		retry       *Retry
+		kind        string
+		attempt     int
+		wantRetries bool
+		wantBackoff time.Duration
+	}{
+		{name: "first failure", retry: retry, kind: RetryOnFailed, attempt: 1, wantRetries: true, wantBackoff: 10 * time.Second},
+		{name: "second failure", retry: retry, kind: RetryOnError, attempt: 2, wantRetries: true, wantBackoff: 30 * time.Second},
+		{name: "capped delay", retry: retry, kind: RetryOnFailed, attempt: 3, wantRetries: true, wantBackoff: time.Minute},
+		{name: "last attempt", retry: retry, kind: RetryOnFailed, attempt: 4, wantRetries: false},
+		{name: "kind not retried", retry: retry, kind: RetryOnTimedOut, attempt: 1, wantRetries: false},
+		{name: "no policy", retry: nil, kind: RetryOnFailed, attempt: 1, wantRetries: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.retry.Retries(tt.kind, tt.attempt); got != tt.wantRetries {
+				t.Errorf("Retries(%q, %d) = %v, want %v", tt.kind, tt.attempt, got, tt.wantRetries)
+			}
+			if !tt.wantRetries {
+				return
+			}
+			if got := tt.retry.Backoff(tt.attempt); got != tt.wantBackoff {
+				t.Errorf("Backoff(%d) = %v, want %v", tt.attempt, got, tt.wantBackoff)
+			}
+		})
+	}
+}
+
+func TestResourcesApplyLimits(t *testing.T) {
+	limits := Resources{CPUs: 4, Memory: 8 << 30, PIDs: 1024}
+
+	tests := []struct {
+		name      string
+		resources Resources
+		want      Resources
+		wantErr   bool
+	}{
+		{
+			name:      "Within limits",
+			resources: Resources{CPUs: 2, Memory: 1 << 30, PIDs: 100, TmpfsSize: 1 << 20},
+			want:      Resources{CPUs: 2, Memory: 1 << 30, PIDs: 100, TmpfsSize: 1 << 20},
+		},
+		{
+			name:      "Unlimited set to the maximum",
+			resources: Resources{CPUs: 1},
+			want:      Resources{CPUs: 1, Memory: 8 << 30, PIDs: 1024},
+		},
+		{
+			name:      "Too many CPUs",
+			resources: Resources{CPUs: 8},
+			wantErr:   true,
+		},
+		{
+			name:      "Too much memory",
+			resources: Resources{Memory: 16 << 30},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.resources
+			err := got.ApplyLimits(limits)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ApplyLimits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ApplyLimits() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
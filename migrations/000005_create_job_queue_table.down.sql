@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_job_queue_enqueued_at;
+DROP TABLE IF EXISTS job_queue;
+
+ALTER TABLE jobs_schedule
+DROP COLUMN IF EXISTS created_at;
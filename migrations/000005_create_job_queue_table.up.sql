@@ -0,0 +1,11 @@
+ALTER TABLE jobs_schedule
+ADD COLUMN IF NOT EXISTS created_at timestamp(0) with time zone NOT NULL DEFAULT NOW();
+
+CREATE TABLE IF NOT EXISTS job_queue (
+    id bigserial PRIMARY KEY,
+    execution_id bigint NOT NULL REFERENCES job_executions(id) ON DELETE CASCADE,
+    job_id bigint NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+    enqueued_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_queue_enqueued_at ON job_queue(enqueued_at);
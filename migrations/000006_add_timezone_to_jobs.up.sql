@@ -0,0 +1,2 @@
+ALTER TABLE jobs
+ADD COLUMN IF NOT EXISTS timezone text NOT NULL DEFAULT 'UTC';
@@ -0,0 +1,3 @@
+ALTER TABLE jobs
+DROP COLUMN IF EXISTS misfire_policy,
+DROP COLUMN IF EXISTS max_lateness;
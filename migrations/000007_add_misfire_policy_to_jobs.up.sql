@@ -0,0 +1,4 @@
+-- max_lateness is stored in nanoseconds, as a Go time.Duration
+ALTER TABLE jobs
+ADD COLUMN IF NOT EXISTS misfire_policy text NOT NULL DEFAULT 'fire_once',
+ADD COLUMN IF NOT EXISTS max_lateness bigint NOT NULL DEFAULT 60000000000;
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_job_executions_job_id_status;
+
+ALTER TABLE job_executions
+DROP COLUMN IF EXISTS reason;
+
+ALTER TABLE jobs
+DROP COLUMN IF EXISTS concurrency_policy;
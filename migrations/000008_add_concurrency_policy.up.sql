@@ -0,0 +1,7 @@
+ALTER TABLE jobs
+ADD COLUMN IF NOT EXISTS concurrency_policy text NOT NULL DEFAULT 'Allow';
+
+ALTER TABLE job_executions
+ADD COLUMN IF NOT EXISTS reason text;
+
+CREATE INDEX IF NOT EXISTS idx_job_executions_job_id_status ON job_executions(job_id, status);
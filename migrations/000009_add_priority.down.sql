@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_jobs_priority;
+
+ALTER TABLE job_queue
+DROP COLUMN IF EXISTS priority;
+
+ALTER TABLE jobs
+DROP COLUMN IF EXISTS priority;
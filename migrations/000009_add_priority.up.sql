@@ -0,0 +1,7 @@
+ALTER TABLE jobs
+ADD COLUMN IF NOT EXISTS priority integer NOT NULL DEFAULT 5;
+
+ALTER TABLE job_queue
+ADD COLUMN IF NOT EXISTS priority integer NOT NULL DEFAULT 5;
+
+CREATE INDEX IF NOT EXISTS idx_jobs_priority ON jobs(priority);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_job_executions_job_id_execution_time;
+
+ALTER TABLE job_executions
+DROP COLUMN IF EXISTS started_at,
+DROP COLUMN IF EXISTS finished_at;
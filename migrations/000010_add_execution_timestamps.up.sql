@@ -0,0 +1,5 @@
+ALTER TABLE job_executions
+ADD COLUMN IF NOT EXISTS started_at timestamp(0) with time zone,
+ADD COLUMN IF NOT EXISTS finished_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS idx_job_executions_job_id_execution_time ON job_executions(job_id, execution_time);
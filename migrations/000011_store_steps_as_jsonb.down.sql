@@ -0,0 +1,13 @@
+ALTER TABLE jobs
+ADD COLUMN steps_text text[] NOT NULL DEFAULT '{}';
+
+UPDATE jobs
+SET steps_text = ARRAY(
+    SELECT step->>'run'
+    FROM jsonb_array_elements(steps) WITH ORDINALITY AS s(step, idx)
+    ORDER BY idx
+);
+
+ALTER TABLE jobs DROP COLUMN steps;
+ALTER TABLE jobs RENAME COLUMN steps_text TO steps;
+ALTER TABLE jobs ALTER COLUMN steps DROP DEFAULT;
@@ -0,0 +1,14 @@
+-- steps become a jsonb array of objects, keeping name, image, env, timeout
+-- and continue_on_error. Existing rows only had the commands.
+ALTER TABLE jobs
+ADD COLUMN steps_json jsonb NOT NULL DEFAULT '[]'::jsonb;
+
+UPDATE jobs
+SET steps_json = (
+    SELECT COALESCE(jsonb_agg(jsonb_build_object('name', '', 'run', step) ORDER BY idx), '[]'::jsonb)
+    FROM unnest(steps) WITH ORDINALITY AS s(step, idx)
+);
+
+ALTER TABLE jobs DROP COLUMN steps;
+ALTER TABLE jobs RENAME COLUMN steps_json TO steps;
+ALTER TABLE jobs ALTER COLUMN steps DROP DEFAULT;
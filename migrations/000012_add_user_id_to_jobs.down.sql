@@ -0,0 +1,11 @@
+ALTER TABLE job_executions DROP CONSTRAINT IF EXISTS fk_job_id;
+ALTER TABLE job_executions
+ADD CONSTRAINT fk_job_id FOREIGN KEY (job_id) REFERENCES jobs(id);
+
+ALTER TABLE jobs_schedule DROP CONSTRAINT IF EXISTS fk_job_id;
+ALTER TABLE jobs_schedule
+ADD CONSTRAINT fk_job_id FOREIGN KEY (job_id) REFERENCES jobs(id);
+
+DROP INDEX IF EXISTS idx_jobs_user_id;
+
+ALTER TABLE jobs DROP COLUMN IF EXISTS user_id;
@@ -0,0 +1,17 @@
+-- jobs are owned by the OIDC subject that submitted them. Jobs created before
+-- this migration have no owner and are not visible through the API.
+ALTER TABLE jobs
+ADD COLUMN IF NOT EXISTS user_id text NOT NULL DEFAULT '';
+
+ALTER TABLE jobs ALTER COLUMN user_id DROP DEFAULT;
+
+CREATE INDEX IF NOT EXISTS idx_jobs_user_id ON jobs(user_id);
+
+-- deleting a job removes its schedule and history
+ALTER TABLE jobs_schedule DROP CONSTRAINT IF EXISTS fk_job_id;
+ALTER TABLE jobs_schedule
+ADD CONSTRAINT fk_job_id FOREIGN KEY (job_id) REFERENCES jobs(id) ON DELETE CASCADE;
+
+ALTER TABLE job_executions DROP CONSTRAINT IF EXISTS fk_job_id;
+ALTER TABLE job_executions
+ADD CONSTRAINT fk_job_id FOREIGN KEY (job_id) REFERENCES jobs(id) ON DELETE CASCADE;
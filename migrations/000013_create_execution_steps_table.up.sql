@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS execution_steps (
+    id bigserial PRIMARY KEY,
+    execution_id bigint NOT NULL REFERENCES job_executions(id) ON DELETE CASCADE,
+    step_index integer NOT NULL,
+    name text NOT NULL,
+    status text NOT NULL,
+    exit_code integer,
+    started_at timestamp(0) with time zone,
+    finished_at timestamp(0) with time zone,
+    -- nanoseconds, like jobs.max_lateness
+    duration bigint NOT NULL DEFAULT 0,
+    -- the step output is log_length bytes of the execution logs, from log_offset
+    log_offset bigint NOT NULL DEFAULT 0,
+    log_length bigint NOT NULL DEFAULT 0,
+    reason text,
+    UNIQUE (execution_id, step_index)
+);
@@ -0,0 +1,3 @@
+-- nanoseconds, 0 means no limit
+ALTER TABLE jobs
+ADD COLUMN IF NOT EXISTS timeout bigint NOT NULL DEFAULT 0;
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_job_queue_available_at;
+ALTER TABLE job_queue DROP COLUMN IF EXISTS available_at;
+
+DROP INDEX IF EXISTS idx_job_executions_retry_of;
+
+ALTER TABLE job_executions
+DROP COLUMN IF EXISTS retry_of,
+DROP COLUMN IF EXISTS attempt;
+
+ALTER TABLE jobs DROP COLUMN IF EXISTS retry;
@@ -0,0 +1,15 @@
+ALTER TABLE jobs
+ADD COLUMN IF NOT EXISTS retry jsonb;
+
+-- retry_of links every retry to the first attempt of the run
+ALTER TABLE job_executions
+ADD COLUMN IF NOT EXISTS attempt integer NOT NULL DEFAULT 1,
+ADD COLUMN IF NOT EXISTS retry_of bigint REFERENCES job_executions(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_job_executions_retry_of ON job_executions(retry_of);
+
+-- a retry waits in the queue until its backoff delay elapsed
+ALTER TABLE job_queue
+ADD COLUMN IF NOT EXISTS available_at timestamp(0) with time zone NOT NULL DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS idx_job_queue_available_at ON job_queue(available_at);
@@ -0,0 +1,3 @@
+ALTER TABLE job_executions DROP COLUMN IF EXISTS commit_sha;
+
+ALTER TABLE jobs DROP COLUMN IF EXISTS source;
@@ -0,0 +1,5 @@
+ALTER TABLE jobs
+ADD COLUMN IF NOT EXISTS source jsonb;
+
+ALTER TABLE job_executions
+ADD COLUMN IF NOT EXISTS commit_sha text;
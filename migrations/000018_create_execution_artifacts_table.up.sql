@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS execution_artifacts (
+    id bigserial PRIMARY KEY,
+    execution_id bigint NOT NULL REFERENCES job_executions(id) ON DELETE CASCADE,
+    -- slash separated path of the file in the workspace
+    path text NOT NULL,
+    size bigint NOT NULL,
+    sha256 text NOT NULL,
+    -- contents are stored by checksum, several artifacts can share a blob
+    blob_key text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (execution_id, path)
+);
@@ -0,0 +1,10 @@
+-- the logs of running executions, published in chunks so that the API streams
+-- them live. They are deleted once the logs are in the blob store.
+CREATE TABLE IF NOT EXISTS execution_log_chunks (
+    execution_id bigint NOT NULL REFERENCES job_executions(id) ON DELETE CASCADE,
+    -- position of the chunk in the execution logs
+    log_offset bigint NOT NULL,
+    data bytea NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (execution_id, log_offset)
+);
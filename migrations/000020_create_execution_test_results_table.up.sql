@@ -0,0 +1,19 @@
+-- the results of the go test -json commands of the steps of the executions
+CREATE TABLE IF NOT EXISTS execution_test_results (
+    id bigserial PRIMARY KEY,
+    execution_id bigint NOT NULL REFERENCES job_executions(id) ON DELETE CASCADE,
+    step_index integer NOT NULL,
+    package text NOT NULL,
+    -- empty for the result of the package, TestName/subtest for a subtest
+    test text NOT NULL DEFAULT '',
+    -- package, test or subtest
+    kind text NOT NULL,
+    -- pass, fail or skip
+    status text NOT NULL,
+    -- nanoseconds, like execution_steps.duration
+    elapsed bigint NOT NULL DEFAULT 0,
+    -- the end of the output of the failed results
+    output text,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (execution_id, step_index, package, test)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE job_executions
+DROP COLUMN IF EXISTS heartbeat_at;
@@ -0,0 +1,8 @@
+-- the executor running an execution refreshes heartbeat_at while it runs, the
+-- scheduler fails the executions whose heartbeat is older than the lease
+ALTER TABLE job_executions
+ADD COLUMN IF NOT EXISTS heartbeat_at timestamp(0) with time zone;
+
+UPDATE job_executions
+SET heartbeat_at = NOW()
+WHERE status IN ('running', 'cancelling');